@@ -4,9 +4,13 @@ go 1.16
 
 require (
 	github.com/ava-labs/avalanchego v1.7.10
+	github.com/golang/snappy v0.0.4
 	github.com/gorilla/rpc v1.2.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/go-plugin v1.4.3
 	github.com/inconshreveable/log15 v0.0.0-20201112154412-8562bdadbbac
+	github.com/prometheus/client_golang v1.11.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.10.0
+	github.com/syndtr/goleveldb v1.0.1-0.20210819022825-2ae1ddf74ef7
 )
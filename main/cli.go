@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+// exit codes of the CLI
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command ran and failed
+	exitUsage   = 2 // the command line was invalid
+)
+
+// command is a CLI subcommand. [flags] defines the command's flags on [fs]
+// and returns the function that runs it once they're parsed.
+type command struct {
+	name        string
+	usage       string // arguments after the command name
+	description string
+	flags       func(fs *pflag.FlagSet) func() error
+}
+
+// commands lists the CLI's subcommands in the order help shows them
+func commands() []command {
+	return []command{
+		{
+			name:        "version",
+			description: "Print the VM's name and version.",
+			flags:       versionFlags,
+		},
+		{
+			name:        "vmid",
+			description: "Print the VM ID avalanchego loads this plugin under, derived from the VM's name.",
+			flags:       vmIDFlags,
+		},
+		{
+			name:        "zcash-ping",
+			usage:       "[--zcash-host <host>] [--zcash-port <port>]",
+			description: "Check that zcashd is reachable and print its height and best block.",
+			flags:       zcashPingFlags,
+		},
+		{
+			name:        genesisCommand,
+			usage:       "[--zcash-host <host>] [--zcash-port <port>]",
+			description: "Print genesisData for a new chain, built from zcashd's genesis block.",
+			flags:       genesisFlags,
+		},
+		{
+			name:        signDisabledChainsCommand,
+			usage:       "(--generate-key | --key-file <file> [--in <file>] [--out <file>])",
+			description: "Sign a disabled chain list for disabledChainsFile, or generate the key pair to sign it with.",
+			flags:       signDisabledChainsFlags,
+		},
+		{
+			name:        inspectDBCommand,
+			usage:       "--db-dir <dir> --chain-id <id>",
+			description: "Print a summary of a stopped node's chain database.",
+			flags:       inspectDBFlags,
+		},
+		{
+			name:        verifyChainCommand,
+			usage:       "--db-dir <dir> --chain-id <id>",
+			description: "Check a stopped node's chain database without writing to it and report every anomaly.",
+			flags:       verifyChainFlags,
+		},
+		{
+			name:        printBlockCommand,
+			usage:       "--db-dir <dir> --chain-id <id> (--id <id> | --height <n>) [--zblock]",
+			description: "Print a block from a stopped node's chain database as JSON.",
+			flags:       printBlockFlags,
+		},
+		{
+			name:        rollbackCommand,
+			usage:       "--db-dir <dir> --chain-id <id> --height <n> [--dry-run]",
+			description: "Roll a stopped node's chain, and its zcashd, back to a height.",
+			flags:       rollbackFlags,
+		},
+		{
+			name:        reseedCommand,
+			usage:       "--db-dir <dir> --chain-id <id> [--batch-size <n>]",
+			description: "Rebuild a fresh zcashd's chain from a stopped node's accepted blocks, resuming an interrupted reseed.",
+			flags:       reseedFlags,
+		},
+		{
+			name:        exportCommand,
+			usage:       "--db-dir <dir> --chain-id <id> [--format jsonl|csv] [--from <n>] [--to <n>] [--zblock] [--out <file>]",
+			description: "Export a stopped node's accepted blocks as JSONL or CSV.",
+			flags:       exportFlags,
+		},
+		{
+			name:        importCommand,
+			usage:       "--db-dir <dir> --chain-id <id> [--in <file>]",
+			description: "Load a JSONL export made with --zblock into a stopped node's empty chain database.",
+			flags:       importFlags,
+		},
+		{
+			name:        snapshotCommand,
+			usage:       "--db-dir <dir> --chain-id <id> --out <file> [--height <n>]",
+			description: "Write a stopped node's chain to a snapshot archive.",
+			flags:       snapshotFlags,
+		},
+	}
+}
+
+// usageError is a problem with the command line rather than with running
+// the command
+type usageError struct{ error }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// runCommand runs the subcommand named by [args][0] and returns the exit code
+func runCommand(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printHelp()
+		return exitOK
+	}
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+		fs := pflag.NewFlagSet(cmd.name, pflag.ContinueOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\n%s\n", zapavm.Name, cmd.name, cmd.usage, cmd.description)
+			if fs.HasFlags() {
+				fmt.Fprintf(os.Stderr, "\nFlags:\n%s", fs.FlagUsages())
+			}
+		}
+		run := cmd.flags(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, pflag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		if fs.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "%s: unexpected arguments %s\n", cmd.name, strings.Join(fs.Args(), " "))
+			fs.Usage()
+			return exitUsage
+		}
+		if err := run(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.name, err)
+			if errors.As(err, &usageError{}) {
+				fs.Usage()
+				return exitUsage
+			}
+			return exitFailure
+		}
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printHelp()
+	return exitUsage
+}
+
+func printHelp() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\n", zapavm.Name)
+	fmt.Fprintf(os.Stderr, "Without a command, %s runs as an avalanchego VM plugin.\n\nCommands:\n", zapavm.Name)
+	for _, cmd := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> --help' for a command's flags.\n", zapavm.Name)
+	fmt.Fprintf(os.Stderr, "Exit codes: %d on success, %d if the command failed, %d for an invalid command line.\n", exitOK, exitFailure, exitUsage)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+const signDisabledChainsCommand = "sign-disabled-chains"
+
+// signDisabledChainsFlags signs a disabled chain list for nodes'
+// disabledChainsFile, or generates the key pair to sign with
+func signDisabledChainsFlags(fs *pflag.FlagSet) func() error {
+	generateKey := fs.Bool("generate-key", false, "Print a new hex ed25519 key pair instead of signing")
+	keyFile := fs.String("key-file", "", "File holding the hex ed25519 private key to sign with")
+	in := fs.String("in", "", "JSON object mapping disabled chain IDs to reasons. Defaults to stdin")
+	out := fs.String("out", "", "Signed file to write. Defaults to stdout")
+	return func() error {
+		if *generateKey {
+			publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return err
+			}
+			return printJSON(map[string]string{
+				"publicKey":  hex.EncodeToString(publicKey),
+				"privateKey": hex.EncodeToString(privateKey),
+			})
+		}
+		if *keyFile == "" {
+			return usageErrorf("--key-file is required")
+		}
+
+		keyHex, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			return err
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(string(keyHex)))
+		if err != nil {
+			return fmt.Errorf("error decoding private key: %w", err)
+		}
+		if len(key) != ed25519.PrivateKeySize {
+			return fmt.Errorf("private key is %d bytes rather than %d", len(key), ed25519.PrivateKeySize)
+		}
+
+		var chainsJSON []byte
+		if *in == "" {
+			chainsJSON, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			chainsJSON, err = ioutil.ReadFile(*in)
+		}
+		if err != nil {
+			return err
+		}
+		list := zapavm.DisabledChainList{IssuedAt: time.Now().Unix()}
+		if err := json.Unmarshal(chainsJSON, &list.Chains); err != nil {
+			return fmt.Errorf("error parsing disabled chains: %w", err)
+		}
+		signed, err := zapavm.SignDisabledChainList(list, ed25519.PrivateKey(key))
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			return printJSON(signed)
+		}
+		signedJSON, err := json.MarshalIndent(signed, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*out, signedJSON, 0o644)
+	}
+}
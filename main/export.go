@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+const (
+	exportCommand = "export"
+	importCommand = "import"
+)
+
+// exportFlags writes a stopped node's accepted blocks to a file or stdout
+func exportFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	format := fs.String("format", zapavm.ExportFormatJSONL, "Output format: jsonl or csv")
+	from := fs.Uint64("from", 0, "First height to export")
+	to := fs.Uint64("to", 0, "Height to stop exporting at, exclusive. Defaults to the end of the chain")
+	includeZBlock := fs.Bool("zblock", false, "Include each block's zcash block and encoded bytes, which imports need")
+	out := fs.String("out", "", "File to write to. Defaults to stdout")
+	return func() error {
+		if *format != zapavm.ExportFormatJSONL && *format != zapavm.ExportFormatCSV {
+			return usageErrorf("unknown format %q", *format)
+		}
+
+		dbManager, vm, err := offline.openVM(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		written, err := vm.ExportChain(w, zapavm.ExportOptions{
+			Format:        *format,
+			FromHeight:    *from,
+			ToHeight:      *to,
+			IncludeZBlock: *includeZBlock,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d blocks\n", written)
+		return nil
+	}
+}
+
+// importFlags loads a JSONL export made with --zblock into a stopped node's
+// empty chain database
+func importFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	in := fs.String("in", "", "JSONL export to import. Defaults to stdin")
+	return func() error {
+		dbManager, db, chainID, err := offline.openDatabase(false)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		var r io.Reader = os.Stdin
+		if *in != "" {
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		last, err := zapavm.ImportChain(db, chainID, r, zapavm.DefaultChainConfig())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "imported blocks through height %d, last accepted block %s\n", last.Height(), last.ID())
+		return nil
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+const genesisCommand = "genesis"
+
+// genesisFlags prints genesisData for a new chain from zcashd's genesis block
+func genesisFlags(fs *pflag.FlagSet) func() error {
+	zcash := addZcashFlags(fs)
+	return func() error {
+		genesis, err := zapavm.GenesisFromZcash(zcash.client())
+		if err != nil {
+			return err
+		}
+		return printJSON(genesis)
+	}
+}
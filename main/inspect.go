@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+const (
+	inspectDBCommand   = "inspect-db"
+	verifyChainCommand = "verify-chain"
+	printBlockCommand  = "print-block"
+)
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(out))
+	return nil
+}
+
+func versionFlags(fs *pflag.FlagSet) func() error {
+	return func() error {
+		fmt.Printf("%s@%s\n", zapavm.Name, zapavm.Version)
+		return nil
+	}
+}
+
+// vmIDFlags prints the VM ID: avalanchego's convention is the VM's name
+// zero-padded to 32 bytes
+func vmIDFlags(fs *pflag.FlagSet) func() error {
+	return func() error {
+		if len(zapavm.Name) > len(ids.Empty) {
+			return fmt.Errorf("VM name %q is longer than %d bytes", zapavm.Name, len(ids.Empty))
+		}
+		vmID := ids.Empty
+		copy(vmID[:], zapavm.Name)
+		fmt.Println(vmID)
+		return nil
+	}
+}
+
+func zcashPingFlags(fs *pflag.FlagSet) func() error {
+	zcash := addZcashFlags(fs)
+	return func() error {
+		zc := zcash.client()
+		height, err := zc.GetBlockCount()
+		if err != nil {
+			return fmt.Errorf("zcashd at %s:%d is unreachable: %w", zc.Host, zc.Port, err)
+		}
+		hash, err := zc.GetBlockHash(height)
+		if err != nil {
+			return fmt.Errorf("error getting zcashd's best block: %w", err)
+		}
+		fmt.Printf("zcashd at %s:%d is at height %d, best block %s\n", zc.Host, zc.Port, height, hash)
+		return nil
+	}
+}
+
+func inspectDBFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	return func() error {
+		dbManager, vm, err := offline.openVM(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		info, err := vm.InspectDatabase()
+		if err != nil {
+			return err
+		}
+		return printJSON(info)
+	}
+}
+
+// verifyChainFlags checks a stopped node's chain database without writing to
+// it, printing every anomaly found
+func verifyChainFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	return func() error {
+		dbManager, db, chainID, err := offline.openDatabase(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		report, err := zapavm.VerifyChainDatabase(db, chainID)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		if len(report.Anomalies) > 0 {
+			return fmt.Errorf("found %d anomalies in chain %s", len(report.Anomalies), chainID)
+		}
+		return nil
+	}
+}
+
+func printBlockFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	blkIDStr := fs.String("id", "", "ID of the block to print")
+	height := fs.Uint64("height", 0, "Height of the accepted block to print")
+	includeZBlock := fs.Bool("zblock", false, "Include the zcash block and the block's encoded bytes")
+	return func() error {
+		if (*blkIDStr == "") == !fs.Changed("height") {
+			return usageErrorf("exactly one of --id and --height is required")
+		}
+		var blkID ids.ID
+		if *blkIDStr != "" {
+			var err error
+			if blkID, err = ids.FromString(*blkIDStr); err != nil {
+				return usageErrorf("invalid block ID: %w", err)
+			}
+		}
+
+		dbManager, vm, err := offline.openVM(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		if *blkIDStr == "" {
+			blk, err := vm.GetBlockAtHeight(*height)
+			if err != nil {
+				return err
+			}
+			row, err := zapavm.ExportBlock(blk, *includeZBlock)
+			if err != nil {
+				return err
+			}
+			return printJSON(row)
+		}
+		blk, err := vm.GetBlockByID(blkID)
+		if err != nil {
+			return err
+		}
+		row, err := zapavm.ExportBlock(blk, *includeZBlock)
+		if err != nil {
+			return err
+		}
+		return printJSON(row)
+	}
+}
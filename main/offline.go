@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/database/manager"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+// zcashFlags select the zcashd a command talks to
+type zcashFlags struct {
+	host     *string
+	port     *int
+	user     *string
+	password *string
+}
+
+func addZcashFlags(fs *pflag.FlagSet) *zcashFlags {
+	return &zcashFlags{
+		host:     fs.String("zcash-host", zclient.ZcashHost, "Host of the chain's zcashd"),
+		port:     fs.Int("zcash-port", zclient.ZcashPort, "Port of the chain's zcashd"),
+		user:     fs.String("zcash-user", zclient.ZcashUser, "RPC user of the zcashd"),
+		password: fs.String("zcash-password", zclient.ZcashPw, "RPC password of the zcashd"),
+	}
+}
+
+func (f *zcashFlags) client() *zclient.ZcashHTTPClient {
+	return &zclient.ZcashHTTPClient{
+		Host:     *f.host,
+		Port:     *f.port,
+		User:     *f.user,
+		Password: *f.password,
+	}
+}
+
+// offlineFlags are the flags shared by commands that work on a stopped
+// node's database
+type offlineFlags struct {
+	*zcashFlags
+	dbDir   *string
+	chainID *string
+}
+
+func addOfflineFlags(fs *pflag.FlagSet) *offlineFlags {
+	return &offlineFlags{
+		zcashFlags: addZcashFlags(fs),
+		dbDir:      fs.String("db-dir", "", "The node's database directory, including the network name (e.g. ~/.avalanchego/db/fuji)"),
+		chainID:    fs.String("chain-id", "", "ID of the chain"),
+	}
+}
+
+// openDatabase opens the chain's database, rejecting writes if [readOnly].
+// The manager must be closed by the caller.
+func (f *offlineFlags) openDatabase(readOnly bool) (manager.Manager, database.Database, ids.ID, error) {
+	if *f.dbDir == "" || *f.chainID == "" {
+		return nil, nil, ids.Empty, usageErrorf("--db-dir and --chain-id are required")
+	}
+	chainID, err := ids.FromString(*f.chainID)
+	if err != nil {
+		return nil, nil, ids.Empty, usageErrorf("invalid chain ID: %w", err)
+	}
+	open := zapavm.OpenNodeDatabase
+	if readOnly {
+		open = zapavm.OpenNodeDatabaseReadOnly
+	}
+	dbManager, db, err := open(*f.dbDir, chainID)
+	return dbManager, db, chainID, err
+}
+
+// openVM opens the chain's database as an offline VM, rejecting writes if
+// [readOnly]. The manager must be closed by the caller.
+func (f *offlineFlags) openVM(readOnly bool) (manager.Manager, *zapavm.VM, error) {
+	dbManager, db, chainID, err := f.openDatabase(readOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	vm, err := zapavm.NewOfflineVM(db, chainID, f.client(), zapavm.DefaultChainConfig())
+	if err != nil {
+		dbManager.Close()
+		return nil, nil, fmt.Errorf("error opening chain %s: %w", chainID, err)
+	}
+	return dbManager, vm, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/zapalabs/zapavm/zapavm"
+)
+
+const reseedCommand = "reseed-zcash"
+
+// reseedFlags rebuilds a fresh zcashd's chain from a stopped node's accepted
+// blocks. Rerunning it after an interruption resumes where zcashd got to.
+func reseedFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	batchSize := fs.Uint64("batch-size", zapavm.DefaultReseedBatchSize, "Blocks to submit between checking zcashd's height")
+	return func() error {
+		if *batchSize == 0 {
+			return usageErrorf("--batch-size must be positive")
+		}
+
+		dbManager, vm, err := offline.openVM(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		result, err := vm.ReseedZcash(zapavm.ReseedOptions{
+			BatchSize: *batchSize,
+			Progress:  printReseedProgress,
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		return printJSON(result)
+	}
+}
+
+// printReseedProgress redraws a progress line on stderr
+func printReseedProgress(p zapavm.ReseedProgress) {
+	var percent float64 = 100
+	if p.TargetHeight > 0 {
+		percent = 100 * float64(p.Height) / float64(p.TargetHeight)
+	}
+	rate := float64(p.Submitted) / p.Elapsed.Seconds()
+	eta := "-"
+	if rate > 0 {
+		eta = (time.Duration(float64(p.TargetHeight-p.Height)/rate) * time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\rheight %d/%d (%.1f%%), %.0f blocks/s, eta %s    ", p.Height, p.TargetHeight, percent, rate, eta)
+}
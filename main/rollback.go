@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/spf13/pflag"
+)
+
+const rollbackCommand = "rollback"
+
+// rollbackFlags rolls a stopped node's chain back to a height
+func rollbackFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	height := fs.Uint64("height", 0, "Height to roll the chain back to")
+	dryRun := fs.Bool("dry-run", false, "Only list the blocks that would be dropped")
+	return func() error {
+		if !fs.Changed("height") {
+			return usageErrorf("--height is required")
+		}
+
+		dbManager, vm, err := offline.openVM(false)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		plan, err := vm.Rollback(*height, *dryRun)
+		if err != nil {
+			return err
+		}
+		return printJSON(plan)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/spf13/pflag"
+)
+
+const snapshotCommand = "snapshot"
+
+// snapshotFlags writes a stopped node's chain to a snapshot archive
+func snapshotFlags(fs *pflag.FlagSet) func() error {
+	offline := addOfflineFlags(fs)
+	height := fs.Uint64("height", 0, "Height to snapshot the chain at. Defaults to the last accepted block")
+	out := fs.String("out", "", "Archive to write")
+	return func() error {
+		if *out == "" {
+			return usageErrorf("--out is required")
+		}
+
+		dbManager, vm, err := offline.openVM(true)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		if !fs.Changed("height") {
+			lastAccepted, err := vm.LastAcceptedBlock()
+			if err != nil {
+				return err
+			}
+			*height = lastAccepted.Height()
+		}
+		manifest, err := vm.WriteSnapshot(*out, *height)
+		if err != nil {
+			return err
+		}
+		return printJSON(manifest)
+	}
+}
@@ -0,0 +1,231 @@
+package zapavm
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	log "github.com/inconshreveable/log15"
+)
+
+// API roles, from least to most privileged
+const (
+	RolePublic = "public"
+	RoleAdmin  = "admin"
+)
+
+// minimum length of an API token
+const minAPITokenLen = 16
+
+// JSON-RPC error code of calls rejected for lack of authorization
+const unauthorizedErrorCode = -32001
+
+// query parameter WebSocket clients, which can't set headers from a
+// browser, may pass their API token in instead of the Authorization header
+const tokenQueryParam = "token"
+
+// largest API request body read, in bytes. Blocks and transactions are
+// submitted hex encoded, so this leaves room for the largest of them.
+const maxAPIRequestSize = 8 * 1024 * 1024
+
+// roleRank orders the roles so a role can call methods of any role below it
+var roleRank = map[string]int{
+	RolePublic: 0,
+	RoleAdmin:  1,
+}
+
+// methodRoles maps methods, lowercased, to the role needed to call them.
+// Methods that aren't listed are public.
+var methodRoles = map[string]string{
+	"zapavm.submittx":               RoleAdmin,
+	"zapavm.zcashrpc":               RoleAdmin,
+	"zapavm.associatezcashhostport": RoleAdmin,
+	"zapavm.planrollback":           RoleAdmin,
+	"zapavm.rollbackchain":          RoleAdmin,
+	"zapavm.setchainenabled":        RoleAdmin,
+	"zapavm.addwebhook":             RoleAdmin,
+	"zapavm.removewebhook":          RoleAdmin,
+	"zapavm.listwebhooks":           RoleAdmin,
+	"zapavm.getwebhookdeadletters":  RoleAdmin,
+}
+
+// APIToken is a bearer token callers present in the Authorization header
+type APIToken struct {
+	Name  string `json:"name"` // identifies the caller in logs
+	Role  string `json:"role"`
+	Token string `json:"token"`
+}
+
+// apiTokenProblems lists what's invalid about [tokens]
+func apiTokenProblems(tokens []APIToken) []string {
+	var problems []string
+	names := make(map[string]bool, len(tokens))
+	values := make(map[string]bool, len(tokens))
+	for i, token := range tokens {
+		if token.Name == "" {
+			problems = append(problems, fmt.Sprintf("apiTokens[%d] has no name", i))
+		} else if names[token.Name] {
+			problems = append(problems, fmt.Sprintf("apiTokens has more than one token named %q", token.Name))
+		}
+		names[token.Name] = true
+		if _, ok := roleRank[token.Role]; !ok {
+			problems = append(problems, fmt.Sprintf("apiTokens[%d] has unknown role %q, expected %q or %q", i, token.Role, RolePublic, RoleAdmin))
+		}
+		if len(token.Token) < minAPITokenLen {
+			problems = append(problems, fmt.Sprintf("apiTokens[%d] is shorter than %d characters", i, minAPITokenLen))
+		} else if values[token.Token] {
+			problems = append(problems, fmt.Sprintf("apiTokens[%d] reuses another entry's token", i))
+		}
+		values[token.Token] = true
+	}
+	return problems
+}
+
+// MethodRole returns the role needed to call [method]
+func MethodRole(method string) string {
+	if role, ok := methodRoles[strings.ToLower(method)]; ok {
+		return role
+	}
+	return RolePublic
+}
+
+// authHandler checks that callers of the JSON-RPC handler it wraps hold the
+// role each method needs
+type authHandler struct {
+	handler http.Handler
+	tokens  []APIToken
+}
+
+func newAuthHandler(handler http.Handler, tokens []APIToken) *authHandler {
+	return &authHandler{handler: handler, tokens: tokens}
+}
+
+// callerKey is the request context key of the token that authorized a
+// WebSocket upgrade
+type callerKey struct{}
+
+// requestCaller returns the token that authorized [r], or nil if [r] was
+// made without one
+func requestCaller(r *http.Request) *APIToken {
+	caller, _ := r.Context().Value(callerKey{}).(*APIToken)
+	return caller
+}
+
+// callerRole returns the role of [caller], which may be nil
+func callerRole(caller *APIToken) string {
+	if caller == nil {
+		return RolePublic
+	}
+	return caller.Role
+}
+
+// caller returns the token presented in [r]'s Authorization header, or for
+// WebSocket upgrades in its token query parameter, if any, and whether one
+// was presented at all
+func (h *authHandler) caller(r *http.Request) (*APIToken, bool) {
+	presented := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if presented == "" && websocket.IsWebSocketUpgrade(r) {
+		presented = r.URL.Query().Get(tokenQueryParam)
+	}
+	if presented == "" {
+		return nil, false
+	}
+	var found *APIToken
+	for i := range h.tokens {
+		// compare against every token so timing doesn't reveal which matched
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(h.tokens[i].Token)) == 1 {
+			found = &h.tokens[i]
+		}
+	}
+	return found, true
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveUpgrade(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	if err != nil && len(body) >= maxAPIRequestSize {
+		log.Warn("Rejected API request above the size limit", "remote", r.RemoteAddr, "limit", maxAPIRequestSize)
+		http.Error(w, fmt.Sprintf("request is larger than %d bytes", maxAPIRequestSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// requests that don't parse are left to the JSON-RPC server to reject
+	req := struct {
+		Method string          `json:"method"`
+		ID     json.RawMessage `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	required := MethodRole(req.Method)
+	caller, presented := h.caller(r)
+	switch {
+	case presented && caller == nil:
+		log.Warn("Rejected API call with an unknown token", "method", req.Method, "remote", r.RemoteAddr)
+		writeUnauthorized(w, http.StatusUnauthorized, req.ID, "unknown API token")
+		return
+	case roleRank[required] == roleRank[RolePublic]:
+	case caller == nil:
+		log.Warn("Rejected unauthenticated API call", "method", req.Method, "role", required, "remote", r.RemoteAddr)
+		writeUnauthorized(w, http.StatusUnauthorized, req.ID, fmt.Sprintf("%s requires the %s role: pass an API token as \"Authorization: Bearer <token>\"", req.Method, required))
+		return
+	case roleRank[caller.Role] < roleRank[required]:
+		log.Warn("Rejected API call without the required role", "method", req.Method, "caller", caller.Name, "role", caller.Role, "required", required)
+		writeUnauthorized(w, http.StatusForbidden, req.ID, fmt.Sprintf("%s requires the %s role and token %q has the %s role", req.Method, required, caller.Name, caller.Role))
+		return
+	}
+	if caller != nil {
+		log.Debug("Authorized API call", "method", req.Method, "caller", caller.Name, "role", caller.Role)
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// serveUpgrade authenticates a WebSocket upgrade. Streams are open to
+// anyone, so only unknown tokens are rejected here; the stream checks the
+// caller's role, passed in the request context, against what it asks for.
+func (h *authHandler) serveUpgrade(w http.ResponseWriter, r *http.Request) {
+	caller, presented := h.caller(r)
+	if presented && caller == nil {
+		log.Warn("Rejected stream with an unknown token", "path", r.URL.Path, "remote", r.RemoteAddr)
+		http.Error(w, "unknown API token", http.StatusUnauthorized)
+		return
+	}
+	if caller != nil {
+		log.Debug("Authorized stream", "path", r.URL.Path, "caller", caller.Name, "role", caller.Role)
+		r = r.WithContext(context.WithValue(r.Context(), callerKey{}, caller))
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// writeUnauthorized writes a JSON-RPC error response
+func writeUnauthorized(w http.ResponseWriter, status int, id json.RawMessage, message string) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error": map[string]interface{}{
+			"code":    unauthorizedErrorCode,
+			"message": message,
+		},
+		"id": id,
+	})
+}
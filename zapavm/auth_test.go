@@ -0,0 +1,113 @@
+package zapavm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testAPITokens = []APIToken{
+	{Name: "ops", Role: RoleAdmin, Token: "admin-token-0123456789"},
+	{Name: "explorer", Role: RolePublic, Token: "public-token-0123456789"},
+}
+
+func TestMethodRole(t *testing.T) {
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{"zapavm.submitTx", RoleAdmin},
+		{"zapavm.submittx", RoleAdmin},
+		{"ZAPAVM.SUBMITTX", RoleAdmin},
+		{"zapavm.zcashRPC", RoleAdmin},
+		{"zapavm.rollbackChain", RoleAdmin},
+		{"zapavm.addWebhook", RoleAdmin},
+		{"zapavm.getBlock", RolePublic},
+		{"zapavm.unknownMethod", RolePublic},
+	}
+	for _, test := range tests {
+		if got := MethodRole(test.method); got != test.want {
+			t.Errorf("MethodRole(%q) = %q, expected %q", test.method, got, test.want)
+		}
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{"public method without token", "zapavm.getBlock", "", http.StatusOK},
+		{"public method with public token", "zapavm.getBlock", "public-token-0123456789", http.StatusOK},
+		{"public method with admin token", "zapavm.getBlock", "admin-token-0123456789", http.StatusOK},
+		{"public method with unknown token", "zapavm.getBlock", "unknown-token-0123456789", http.StatusUnauthorized},
+		{"admin method without token", "zapavm.submitTx", "", http.StatusUnauthorized},
+		{"admin method with public token", "zapavm.submitTx", "public-token-0123456789", http.StatusForbidden},
+		{"admin method with admin token", "zapavm.submitTx", "admin-token-0123456789", http.StatusOK},
+		{"admin method with unknown token", "zapavm.submitTx", "unknown-token-0123456789", http.StatusUnauthorized},
+		{"admin method in other casing", "ZAPAVM.SubmitTX", "", http.StatusUnauthorized},
+		{"admin method in other casing with public token", "zapavm.SUBMITTX", "public-token-0123456789", http.StatusForbidden},
+		{"admin method in other casing with admin token", "Zapavm.submittx", "admin-token-0123456789", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served := false
+			handler := newAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}), testAPITokens)
+
+			body := `{"jsonrpc":"2.0","method":"` + test.method + `","params":[{}],"id":1}`
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, expected %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			if served != (test.wantStatus == http.StatusOK) {
+				t.Fatalf("wrapped handler served = %v with status %d", served, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandlerUnparsedRequest(t *testing.T) {
+	// requests that aren't JSON are left to the JSON-RPC server to reject
+	served := false
+	handler := newAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}), testAPITokens)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("not json"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !served {
+		t.Fatal("unparsed request wasn't passed on")
+	}
+}
+
+func TestAPITokenProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []APIToken
+		want   int
+	}{
+		{"valid", testAPITokens, 0},
+		{"no name", []APIToken{{Role: RoleAdmin, Token: "admin-token-0123456789"}}, 1},
+		{"duplicate name", []APIToken{testAPITokens[0], {Name: "ops", Role: RoleAdmin, Token: "other-token-0123456789"}}, 1},
+		{"unknown role", []APIToken{{Name: "ops", Role: "root", Token: "admin-token-0123456789"}}, 1},
+		{"short token", []APIToken{{Name: "ops", Role: RoleAdmin, Token: "short"}}, 1},
+		{"reused token", []APIToken{testAPITokens[0], {Name: "other", Role: RolePublic, Token: "admin-token-0123456789"}}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if problems := apiTokenProblems(test.tokens); len(problems) != test.want {
+				t.Fatalf("apiTokenProblems() = %q, expected %d problems", problems, test.want)
+			}
+		})
+	}
+}
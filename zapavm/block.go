@@ -8,9 +8,8 @@ import (
 	"fmt"
 	"time"
 
-	nativejson "encoding/json"
-
 	log "github.com/inconshreveable/log15"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
 
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/snow/choices"
@@ -22,6 +21,7 @@ var (
 	errTimestampTooEarly = errors.New("block's timestamp is earlier than its parent's timestamp")
 	errDatabaseGet       = errors.New("error while retrieving data from database")
 	errTimestampTooLate  = errors.New("block's timestamp is more than 1 hour ahead of local time")
+	errWrongCodecVersion = errors.New("block has the wrong codec version for its height")
 
 	_ snowman.Block = &Block{}
 )
@@ -34,7 +34,7 @@ var (
 type Block struct {
 	PrntID ids.ID                   `serialize:"true" json:"parentID"`  // parent's ID
 	Hght   uint64                   `serialize:"true" json:"height"`    // This block's height. The genesis block is at height 0.
-	ZBlk   nativejson.RawMessage    `serialize:"true" json:"zblock"`    // zcash block
+	ZBlk   []byte                   `serialize:"true" json:"zblock"`    // raw zcash block
 	CreationTime int64              `serialize:"true" json:"creationTime"`
 	ProducingNode string            `serialize:"true" json:"producingNode"`
 
@@ -42,11 +42,55 @@ type Block struct {
 	bytes  []byte         // this block's encoded bytes
 	status choices.Status // block's status
 	vm     *VM            // the underlying VM reference, mostly used for state
+
+	codecVersion uint16 // codec version [bytes] were marshalled with
+
+	pruned bool   // whether ZBlk was pruned from the database and must be fetched from zcashd
+	zhash  string // hash of the zcash block, once computed or read from the pruned header
+}
+
+// parseBlock unmarshals [bytes] into a Block and initializes it with
+// [status] and [vm]. Blocks marshalled with [legacyCodecVersion] carry
+// zcashd's JSON-wrapped hex in ZBlk; it is decoded here so ZBlk is always
+// the raw zcash block in memory. [bytes] are kept as-is so the ID is unchanged.
+func parseBlock(bytes []byte, status choices.Status, vm *VM) (*Block, error) {
+	blk := &Block{}
+	version, err := Codec.Unmarshal(bytes, blk)
+	if err != nil {
+		return nil, err
+	}
+	if version == legacyCodecVersion {
+		zblk, err := zclient.DecodeZBlock(blk.ZBlk)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding legacy zcash block: %w", err)
+		}
+		blk.ZBlk = zblk
+	}
+	blk.codecVersion = version
+	blk.Initialize(bytes, status, vm)
+	return blk, nil
+}
+
+// checkCodecVersion returns an error if this block isn't in the format
+// required at its height: legacyCodecVersion until UpgradeRawZcashBlocks is
+// active and CodecVersion after
+func (b *Block) checkCodecVersion() error {
+	if want := b.vm.blockCodecVersion(b.Height(), b.CreationTime); b.codecVersion != want {
+		return fmt.Errorf("%w: block at height %d has codec version %d, expected %d", errWrongCodecVersion, b.Height(), b.codecVersion, want)
+	}
+	return nil
 }
 
 // Verify returns nil iff this block is valid.
 func (b *Block) Verify() error {
 	log.Debug("Block.Verify: begin", b.LogInfo()...)
+	if err := b.checkCodecVersion(); err != nil {
+		return err
+	}
+	// nothing is accepted in maintenance mode, so the chain can be rolled back
+	if b.vm.config.MaintenanceMode {
+		return errMaintenanceMode
+	}
 	if b.ZBlock() != nil {
 		err := b.vm.zc.ValidateBlock(b.ZBlock()) 
 		if err != nil {
@@ -78,6 +122,10 @@ func (b *Block) Accept() error {
 	log.Debug("Block.Accept: begin", b.LogInfo()...)
 
 	if b.Height() > 0 {
+		// a block a rollback dropped is invalid in zcashd until reconsidered
+		if err := b.vm.reconsiderRolledBackZcash(b); err != nil {
+			log.Error("Error reconsidering rolled back zcash block", append(b.LogInfo(), "error", err)...)
+		}
 		// Needs to be synced with Zcash Client
 		log.Debug("Calling zcash submit block", b.LogInfo()...)
 		b.vm.zc.SubmitBlock(b.ZBlock())
@@ -99,10 +147,24 @@ func (b *Block) Accept() error {
 	// Delete this block from verified blocks as it's accepted
 	delete(b.vm.verifiedBlocks, b.ID())
 
+	if err := b.vm.indexAcceptedBlock(b); err != nil {
+		return fmt.Errorf("error indexing accepted block: %w", err)
+	}
+
+	// Drop zcash blocks that fell out of the retention window. Failing to
+	// prune only costs disk space, so it doesn't fail the accept.
+	if err := b.vm.pruneBlocks(); err != nil {
+		log.Warn("Error pruning blocks", "error", err)
+	}
+
 	log.Info("Block.Accept: returning. Successfully accepted block", b.LogInfo()...)
 
 	// Commit changes to database
-	return b.vm.state.Commit()
+	if err := b.vm.state.Commit(); err != nil {
+		return err
+	}
+	b.vm.publishBlock(EventBlockAccepted, b)
+	return nil
 }
 
 // Reject sets this block's status to Rejected and saves the status in state
@@ -117,7 +179,11 @@ func (b *Block) Reject() error {
 	// Delete this block from verified blocks as it's rejected
 	delete(b.vm.verifiedBlocks, b.ID())
 	// Commit changes to database
-	return b.vm.state.Commit()
+	if err := b.vm.state.Commit(); err != nil {
+		return err
+	}
+	b.vm.publishBlock(EventBlockRejected, b)
+	return nil
 }
 
 // ID returns the ID of this block
@@ -138,13 +204,33 @@ func (b *Block) Timestamp() time.Time {
 // Status returns the status of this block
 func (b *Block) Status() choices.Status { return b.status }
 
-// Bytes returns the byte repr. of this block
+// Bytes returns the byte repr. of this block. GetBlock loads the payload of
+// pruned blocks before handing them to consensus; elsewhere use LoadBytes.
 func (b *Block) Bytes() []byte { return b.bytes }
 
-func (b *Block) ZBlock() nativejson.RawMessage {
-	return b.ZBlk
+// ZBlock returns the raw serialized zcash block. It is nil for a pruned
+// block whose payload wasn't loaded; use LoadZBlock for those.
+func (b *Block) ZBlock() []byte { return b.ZBlk }
+
+// ZcashHash returns the hash of this block's zcash block, as zcashd displays it
+func (b *Block) ZcashHash() (string, error) {
+	if b.zhash == "" {
+		zblk, err := b.LoadZBlock()
+		if err != nil {
+			return "", err
+		}
+		zhash, err := zclient.ZBlockHash(zblk)
+		if err != nil {
+			return "", fmt.Errorf("error hashing zcash block: %w", err)
+		}
+		b.zhash = zhash
+	}
+	return b.zhash, nil
 }
 
+// Pruned returns whether this block's zcash block was pruned from the database
+func (b *Block) Pruned() bool { return b.pruned }
+
 // SetStatus sets the status of this block
 func (b *Block) SetStatus(status choices.Status) { b.status = status }
 
@@ -0,0 +1,72 @@
+package zapavm
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	// CompressionNone stores block bytes as-is
+	CompressionNone = "none"
+	// CompressionSnappy stores block bytes snappy-compressed
+	CompressionSnappy = "snappy"
+)
+
+// blkFlags is the header stored in blkWrapper next to the block bytes.
+// It describes how [blkWrapper.Blk] is encoded on disk.
+type blkFlags byte
+
+const (
+	// blkFlagSnappy is set when Blk is snappy-compressed
+	blkFlagSnappy blkFlags = 1 << iota
+	// blkFlagPruned is set when Blk holds a prunedBlock rather than the block
+	blkFlagPruned
+)
+
+// compressionFlags returns the header flags for the compression named [name]
+func compressionFlags(name string) (blkFlags, error) {
+	switch name {
+	case "", CompressionNone:
+		return 0, nil
+	case CompressionSnappy:
+		return blkFlagSnappy, nil
+	default:
+		return 0, fmt.Errorf("unknown block compression %q, expected %q or %q", name, CompressionNone, CompressionSnappy)
+	}
+}
+
+// compressBlk encodes [blkBytes] according to [flags]. It returns the stored
+// bytes along with the flags that actually apply: blocks that don't shrink
+// when compressed are stored uncompressed.
+func compressBlk(flags blkFlags, blkBytes []byte) ([]byte, blkFlags) {
+	if flags&blkFlagSnappy == 0 {
+		return blkBytes, 0
+	}
+	compressed := snappy.Encode(nil, blkBytes)
+	if len(compressed) >= len(blkBytes) {
+		return blkBytes, 0
+	}
+	return compressed, blkFlagSnappy
+}
+
+// decompressBlk reverses compressBlk
+func decompressBlk(flags blkFlags, stored []byte) ([]byte, error) {
+	if flags&blkFlagSnappy == 0 {
+		return stored, nil
+	}
+	blkBytes, err := snappy.Decode(nil, stored)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing block: %w", err)
+	}
+	return blkBytes, nil
+}
+
+// decompressedLen returns the length of the block bytes in [stored] without
+// decompressing them
+func decompressedLen(flags blkFlags, stored []byte) (int, error) {
+	if flags&blkFlagSnappy == 0 {
+		return len(stored), nil
+	}
+	return snappy.DecodedLen(stored)
+}
@@ -0,0 +1,74 @@
+package zapavm
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+)
+
+// encodings block payloads can be returned in by the API
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+	EncodingJSON   = "json"
+)
+
+// BlockJSON is a block's payload decoded into its fields
+type BlockJSON struct {
+	ParentID      ids.ID `json:"parentID"`
+	Height        uint64 `json:"height"`
+	ZBlock        string `json:"zblock"` // hex of the zcash block, as zcashd serializes it
+	CreationTime  int64  `json:"creationTime"`
+	ProducingNode string `json:"producingNode"`
+}
+
+// encodeBlock returns [block]'s bytes in [encoding], which defaults to hex
+func encodeBlock(block *Block, encoding string) (interface{}, error) {
+	switch encoding {
+	case "", EncodingHex:
+		return hex.EncodeToString(block.Bytes()), nil
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(block.Bytes()), nil
+	case EncodingJSON:
+		return BlockJSON{
+			ParentID:      block.Parent(),
+			Height:        block.Height(),
+			ZBlock:        hex.EncodeToString(block.ZBlock()),
+			CreationTime:  block.CreationTime,
+			ProducingNode: block.ProducingNode,
+		}, nil
+	default:
+		return nil, checkEncoding(encoding)
+	}
+}
+
+// checkEncoding returns an error if [encoding] isn't one encodeBlock supports
+func checkEncoding(encoding string) error {
+	switch encoding {
+	case "", EncodingHex, EncodingBase64, EncodingJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding %q, expected %q, %q or %q", encoding, EncodingHex, EncodingBase64, EncodingJSON)
+	}
+}
+
+// blocksCursor returns the getBlocks cursor of a page starting at [height]
+func blocksCursor(height uint64) string {
+	return hex.EncodeToString(database.PackUInt64(height))
+}
+
+// parseBlocksCursor returns the height a getBlocks cursor starts at
+func parseBlocksCursor(cursor string) (uint64, error) {
+	b, err := hex.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	height, err := database.ParseUInt64(b)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return height, nil
+}
@@ -0,0 +1,127 @@
+package zapavm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/database/memdb"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow"
+	"github.com/ava-labs/avalanchego/snow/choices"
+)
+
+func TestBlocksCursor(t *testing.T) {
+	for _, height := range []uint64{0, 1, 255, 256, 1 << 32, math.MaxUint64} {
+		got, err := parseBlocksCursor(blocksCursor(height))
+		if err != nil {
+			t.Fatalf("parseBlocksCursor(blocksCursor(%d)) error = %v", height, err)
+		}
+		if got != height {
+			t.Fatalf("parseBlocksCursor(blocksCursor(%d)) = %d", height, got)
+		}
+	}
+}
+
+func TestParseBlocksCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    uint64
+		wantErr bool
+	}{
+		{"zero", "0000000000000000", 0, false},
+		{"height", "000000000000000a", 10, false},
+		{"upper case", "000000000000000A", 10, false},
+		{"not hex", "zz00000000000000", 0, true},
+		{"odd length", "000000000000000", 0, true},
+		{"short", "0a", 0, true},
+		{"long", "00000000000000000a", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseBlocksCursor(test.cursor)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseBlocksCursor(%q) error = %v, expected error: %v", test.cursor, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Fatalf("parseBlocksCursor(%q) = %d, expected %d", test.cursor, got, test.want)
+			}
+		})
+	}
+}
+
+// newTestChainVM returns a VM whose state holds an accepted chain of
+// [numBlocks] blocks
+func newTestChainVM(t *testing.T, numBlocks int) *VM {
+	vm := &VM{ctx: snow.DefaultContextTest()}
+	vm.state = NewState(memdb.New(), vm)
+	parentID := ids.Empty
+	for height := 0; height < numBlocks; height++ {
+		blk, err := vm.NewBlock(parentID, uint64(height), testGenesisZBlock(byte(height)), int64(1000+height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blk.status = choices.Accepted
+		if err := vm.state.PutBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.state.SetLastAccepted(blk.ID()); err != nil {
+			t.Fatal(err)
+		}
+		parentID = blk.ID()
+	}
+	return vm
+}
+
+func TestGetBlocksPages(t *testing.T) {
+	s := &Service{vm: newTestChainVM(t, 10)}
+	uint64p := func(n uint64) *uint64 { return &n }
+
+	tests := []struct {
+		name        string
+		args        GetBlocksArgs
+		wantHeights [][]uint64 // heights of each page
+	}{
+		{"one page", GetBlocksArgs{}, [][]uint64{{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}}},
+		{"even pages", GetBlocksArgs{Limit: 5}, [][]uint64{{0, 1, 2, 3, 4}, {5, 6, 7, 8, 9}}},
+		{"uneven pages", GetBlocksArgs{Limit: 4}, [][]uint64{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9}}},
+		{"from height", GetBlocksArgs{FromHeight: 7, Limit: 2}, [][]uint64{{7, 8}, {9}}},
+		{"to height", GetBlocksArgs{ToHeight: uint64p(5), Limit: 3}, [][]uint64{{0, 1, 2}, {3, 4}}},
+		{"to height past the tip", GetBlocksArgs{FromHeight: 8, ToHeight: uint64p(100)}, [][]uint64{{8, 9}}},
+		{"from past the tip", GetBlocksArgs{FromHeight: 10}, [][]uint64{{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			for page, wantHeights := range test.wantHeights {
+				reply := GetBlocksReply{}
+				if err := s.GetBlocks(nil, &args, &reply); err != nil {
+					t.Fatal(err)
+				}
+				if len(reply.Blocks) != len(wantHeights) {
+					t.Fatalf("page %d has %d blocks, expected %d", page, len(reply.Blocks), len(wantHeights))
+				}
+				for i, blk := range reply.Blocks {
+					if uint64(blk.Height) != wantHeights[i] {
+						t.Fatalf("page %d block %d is at height %d, expected %d", page, i, blk.Height, wantHeights[i])
+					}
+				}
+				lastPage := page == len(test.wantHeights)-1
+				if lastPage != (reply.Cursor == "") {
+					t.Fatalf("page %d cursor = %q, last page: %v", page, reply.Cursor, lastPage)
+				}
+				// the cursor takes the place of FromHeight
+				args.FromHeight = 0
+				args.Cursor = reply.Cursor
+			}
+		})
+	}
+}
+
+func TestGetBlocksInvalidCursor(t *testing.T) {
+	s := &Service{vm: newTestChainVM(t, 1)}
+	reply := GetBlocksReply{}
+	if err := s.GetBlocks(nil, &GetBlocksArgs{Cursor: "not a cursor"}, &reply); err == nil {
+		t.Fatal("GetBlocks accepted an invalid cursor")
+	}
+}
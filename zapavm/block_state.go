@@ -4,6 +4,10 @@
 package zapavm
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
 	"github.com/ava-labs/avalanchego/cache"
 	"github.com/ava-labs/avalanchego/database"
 	"github.com/ava-labs/avalanchego/ids"
@@ -12,6 +16,7 @@ import (
 
 const (
 	lastAcceptedByte byte = iota
+	prunedHeightByte
 )
 
 const (
@@ -22,6 +27,11 @@ const (
 // persists lastAccepted block IDs with this key
 var lastAcceptedKey = []byte{lastAcceptedByte}
 
+// persists the height below which accepted blocks are pruned with this key
+var prunedHeightKey = []byte{prunedHeightByte}
+
+var errShortBlkWrapper = errors.New("stored block is too short to hold a codec version")
+
 var _ BlockState = &blockState{}
 
 // BlockState defines methods to manage state with Blocks and LastAcceptedIDs.
@@ -29,6 +39,12 @@ type BlockState interface {
 	GetBlock(blkID ids.ID) (*Block, error)
 	PutBlock(blk *Block) error
 	GetLastAcceptedBlock() (*Block, error) 
+	StorageStats() (StorageStats, error)
+	PruneBlock(blk *Block) error
+	DeleteBlock(blkID ids.ID) error
+	ForEachBlock(f func(blk *Block) error) error
+	GetPrunedHeight() (uint64, error)
+	SetPrunedHeight(height uint64) error
 
 	GetLastAccepted() (ids.ID, error)
 	SetLastAccepted(ids.ID) error
@@ -42,25 +58,78 @@ type blockState struct {
 	blockDB      database.Database
 	lastAccepted ids.ID
 
+	// compression applied to blocks written by PutBlock
+	compression blkFlags
+
 	// vm reference
 	vm *VM
 }
 
-// blkWrapper wraps the actual blk bytes and status to persist them together
+// blkWrapper wraps the actual blk bytes and status to persist them together.
+// Flags describe how Blk is encoded on disk.
 type blkWrapper struct {
 	Blk    []byte         `serialize:"true"`
 	Status choices.Status `serialize:"true"`
+	Flags  blkFlags       `serialize:"true"`
+}
+
+// legacyBlkWrapper is the layout of wrappers written before
+// [blkWrapperCodecVersion], which have no header flags
+type legacyBlkWrapper struct {
+	Blk    []byte         `serialize:"true"`
+	Status choices.Status `serialize:"true"`
+}
+
+// StorageStats summarizes the blocks stored in the block database
+type StorageStats struct {
+	Blocks           int     `json:"blocks"`
+	CompressedBlocks int     `json:"compressedBlocks"`
+	PrunedBlocks     int     `json:"prunedBlocks"`
+	BlockBytes       uint64  `json:"blockBytes"`       // uncompressed size of all stored blocks
+	StoredBytes      uint64  `json:"storedBytes"`      // bytes on disk for all stored blocks, keys included
+	CompressionRatio float64 `json:"compressionRatio"` // BlockBytes / StoredBytes
 }
 
 // NewBlockState returns BlockState with a new cache and given db
 func NewBlockState(db database.Database, vm *VM) BlockState {
+	// the config is validated in Initialize, so an unknown compression
+	// can only mean the default
+	compression, _ := compressionFlags(vm.config.BlockCompression)
 	return &blockState{
-		blkCache: &cache.LRU{Size: blockCacheSize},
-		blockDB:  db,
-		vm:       vm,
+		blkCache:    &cache.LRU{Size: blockCacheSize},
+		blockDB:     db,
+		compression: compression,
+		vm:          vm,
 	}
 }
 
+// unmarshalBlkWrapper decodes [wrappedBytes] written at any wrapper version
+// and returns the wrapper with Blk decompressed
+func unmarshalBlkWrapper(wrappedBytes []byte) (blkWrapper, error) {
+	blkw := blkWrapper{}
+	if len(wrappedBytes) < 2 {
+		return blkw, errShortBlkWrapper
+	}
+	if binary.BigEndian.Uint16(wrappedBytes) < blkWrapperCodecVersion {
+		legacy := legacyBlkWrapper{}
+		if _, err := Codec.Unmarshal(wrappedBytes, &legacy); err != nil {
+			return blkw, err
+		}
+		blkw.Blk = legacy.Blk
+		blkw.Status = legacy.Status
+		return blkw, nil
+	}
+	if _, err := Codec.Unmarshal(wrappedBytes, &blkw); err != nil {
+		return blkw, err
+	}
+	blkBytes, err := decompressBlk(blkw.Flags, blkw.Blk)
+	if err != nil {
+		return blkw, err
+	}
+	blkw.Blk = blkBytes
+	return blkw, nil
+}
+
 // GetBlock gets Block from either cache or database
 func (s *blockState) GetBlock(blkID ids.ID) (*Block, error) {
 	// Check if cache has this blkID
@@ -86,37 +155,89 @@ func (s *blockState) GetBlock(blkID ids.ID) (*Block, error) {
 		return nil, err
 	}
 
-	// first decode/unmarshal the block wrapper so we can have status and block bytes
-	blkw := blkWrapper{}
-	if _, err := Codec.Unmarshal(wrappedBytes, &blkw); err != nil {
+	blk, err := s.decodeBlock(blkID, wrappedBytes)
+	if err != nil {
 		return nil, err
 	}
 
-	// now decode/unmarshal the actual block bytes to block
-	blk := &Block{}
-	if _, err := Codec.Unmarshal(blkw.Blk, blk); err != nil {
+	// put block into cache
+	s.blkCache.Put(blkID, blk)
+
+	return blk, nil
+}
+
+// decodeBlock decodes the stored form of block [blkID]
+func (s *blockState) decodeBlock(blkID ids.ID, wrappedBytes []byte) (*Block, error) {
+	return decodeStoredBlock(blkID, wrappedBytes, s.vm)
+}
+
+// decodeStoredBlock decodes the stored form of block [blkID] for [vm]
+func decodeStoredBlock(blkID ids.ID, wrappedBytes []byte, vm *VM) (*Block, error) {
+	// first decode/unmarshal the block wrapper so we can have status and block bytes
+	blkw, err := unmarshalBlkWrapper(wrappedBytes)
+	if err != nil {
 		return nil, err
 	}
 
-	// initialize block with block bytes, status and vm
-	blk.Initialize(blkw.Blk, blkw.Status, s.vm)
+	// now decode/unmarshal the actual block bytes to block and initialize
+	// it with block bytes, status and vm
+	if blkw.Flags&blkFlagPruned != 0 {
+		return parsePrunedBlock(blkID, blkw.Blk, blkw.Status, vm)
+	}
+	return parseBlock(blkw.Blk, blkw.Status, vm)
+}
 
-	// put block into cache
-	s.blkCache.Put(blkID, blk)
+// ForEachBlock calls [f] with every stored block, in key order, until [f]
+// returns an error. Blocks are read without going through the cache.
+func (s *blockState) ForEachBlock(f func(blk *Block) error) error {
+	it := s.blockDB.NewIterator()
+	defer it.Release()
 
-	return blk, nil
+	for it.Next() {
+		// skip singleton keys such as lastAcceptedKey
+		if len(it.Key()) != len(ids.Empty) {
+			continue
+		}
+		blkID, err := ids.ToID(it.Key())
+		if err != nil {
+			return err
+		}
+		blk, err := s.decodeBlock(blkID, it.Value())
+		if err != nil {
+			return fmt.Errorf("error decoding block %s: %w", blkID, err)
+		}
+		if err := f(blk); err != nil {
+			return err
+		}
+	}
+	return it.Error()
 }
 
 // PutBlock puts block into both database and cache
 func (s *blockState) PutBlock(blk *Block) error {
-	// create block wrapper with block bytes and status
+	// create block wrapper with (possibly compressed) block bytes and status.
+	// pruned blocks keep their pruned form rather than refetching the zcash block
+	var (
+		stored []byte
+		flags  blkFlags
+	)
+	if blk.pruned {
+		var err error
+		if stored, err = marshalPrunedBlock(blk); err != nil {
+			return err
+		}
+		flags = blkFlagPruned
+	} else {
+		stored, flags = compressBlk(s.compression, blk.Bytes())
+	}
 	blkw := blkWrapper{
-		Blk:    blk.Bytes(),
+		Blk:    stored,
 		Status: blk.Status(),
+		Flags:  flags,
 	}
 
 	// encode block wrapper to its byte representation
-	wrappedBytes, err := Codec.Marshal(CodecVersion, &blkw)
+	wrappedBytes, err := Codec.Marshal(blkWrapperCodecVersion, &blkw)
 	if err != nil {
 		return err
 	}
@@ -129,9 +250,43 @@ func (s *blockState) PutBlock(blk *Block) error {
 	return s.blockDB.Put(blkID[:], wrappedBytes)
 }
 
-// DeleteBlock deletes block from both cache and database
+// PruneBlock replaces the stored copy of [blk] with its pruned form, which
+// drops the zcash block. The block's bytes can later be rebuilt from zcashd.
+func (s *blockState) PruneBlock(blk *Block) error {
+	if blk.pruned {
+		return nil
+	}
+	if _, err := blk.ZcashHash(); err != nil {
+		return err
+	}
+	blk.pruned = true
+	if err := s.PutBlock(blk); err != nil {
+		return err
+	}
+	// keep the payload out of the cache as well, so pruning frees memory
+	// and the block behaves the same whether or not it was cached
+	s.blkCache.Evict(blk.ID())
+	return nil
+}
+
+// GetPrunedHeight returns the height below which accepted blocks are pruned
+func (s *blockState) GetPrunedHeight() (uint64, error) {
+	height, err := database.GetUInt64(s.blockDB, prunedHeightKey)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	return height, err
+}
+
+// SetPrunedHeight persists the height below which accepted blocks are pruned
+func (s *blockState) SetPrunedHeight(height uint64) error {
+	return database.PutUInt64(s.blockDB, prunedHeightKey, height)
+}
+
+// DeleteBlock deletes block from both cache and database, including any
+// cached record of the block being missing
 func (s *blockState) DeleteBlock(blkID ids.ID) error {
-	s.blkCache.Put(blkID, nil)
+	s.blkCache.Evict(blkID)
 	return s.blockDB.Delete(blkID[:])
 }
 
@@ -176,3 +331,56 @@ func (s *blockState) SetLastAccepted(lastAccepted ids.ID) error {
 	// persist lastAccepted ID to database with fixed lastAcceptedKey
 	return s.blockDB.Put(lastAcceptedKey, lastAccepted[:])
 }
+
+// StorageStats walks the block database and reports how much space stored
+// blocks take up, compressed and uncompressed
+func (s *blockState) StorageStats() (StorageStats, error) {
+	stats := StorageStats{}
+	it := s.blockDB.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		// skip singleton keys such as lastAcceptedKey
+		if len(key) != len(ids.Empty) {
+			continue
+		}
+		value := it.Value()
+		if len(value) < 2 {
+			return stats, fmt.Errorf("error decoding block %x: %w", key, errShortBlkWrapper)
+		}
+		stats.Blocks++
+		stats.StoredBytes += uint64(len(key) + len(value))
+
+		if binary.BigEndian.Uint16(value) < blkWrapperCodecVersion {
+			legacy := legacyBlkWrapper{}
+			if _, err := Codec.Unmarshal(value, &legacy); err != nil {
+				return stats, fmt.Errorf("error decoding block %x: %w", key, err)
+			}
+			stats.BlockBytes += uint64(len(legacy.Blk))
+			continue
+		}
+		blkw := blkWrapper{}
+		if _, err := Codec.Unmarshal(value, &blkw); err != nil {
+			return stats, fmt.Errorf("error decoding block %x: %w", key, err)
+		}
+		n, err := decompressedLen(blkw.Flags, blkw.Blk)
+		if err != nil {
+			return stats, fmt.Errorf("error decoding block %x: %w", key, err)
+		}
+		if blkw.Flags&blkFlagSnappy != 0 {
+			stats.CompressedBlocks++
+		}
+		if blkw.Flags&blkFlagPruned != 0 {
+			stats.PrunedBlocks++
+		}
+		stats.BlockBytes += uint64(n)
+	}
+	if err := it.Error(); err != nil {
+		return stats, err
+	}
+	if stats.StoredBytes > 0 {
+		stats.CompressionRatio = float64(stats.BlockBytes) / float64(stats.StoredBytes)
+	}
+	return stats, nil
+}
@@ -0,0 +1,191 @@
+package zapavm
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// sources a chain's enablement can come from, most specific last
+const (
+	EnablementSourceDefault = "default"
+	EnablementSourceConfig  = "config"
+	EnablementSourceFile    = "disabledChainsFile"
+	EnablementSourceAdmin   = "admin"
+)
+
+// builtinDisabledChains are the chains zapavm releases disabled before the
+// disabled chain list was configurable. They apply unless the chain config
+// sets disabledChains.
+var builtinDisabledChains = map[string]string{
+	"HydwMTPrYBWHrGVmWfG8k4Po2eTPEqe7y7Z4jZaUr2Me6rin7":  "hard-coded as disabled by earlier zapavm releases",
+	"2LedqoeDb3zZQSqPBczemzrofepr6SzSHXxHXANrfzeFKGGNVd": "hard-coded as disabled by earlier zapavm releases",
+}
+
+var (
+	errChainDisabled              = errors.New("chain is disabled")
+	errBadDisabledChainsSignature = errors.New("disabledChainsFile signature doesn't verify against disabledChainsPublicKey")
+)
+
+// DisabledChainList is the payload of a signed disabled chains file
+type DisabledChainList struct {
+	// Chains maps disabled chain IDs to why they are disabled
+	Chains map[string]string `json:"chains"`
+	// IssuedAt is when the list was signed, in unix seconds
+	IssuedAt int64 `json:"issuedAt"`
+}
+
+// SignedDisabledChainList is a disabled chains file: a DisabledChainList
+// and its ed25519 signature, both base64 encoded
+type SignedDisabledChainList struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// SignDisabledChainList signs [list] with [key]
+func SignDisabledChainList(list DisabledChainList, key ed25519.PrivateKey) (SignedDisabledChainList, error) {
+	payload, err := json.Marshal(list)
+	if err != nil {
+		return SignedDisabledChainList{}, err
+	}
+	return SignedDisabledChainList{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}, nil
+}
+
+// readDisabledChainsFile reads the signed disabled chains file at [path]
+// and verifies it against the hex ed25519 public key [publicKeyHex]
+func readDisabledChainsFile(path string, publicKeyHex string) (DisabledChainList, error) {
+	list := DisabledChainList{}
+	publicKey, err := parseEd25519PublicKey(publicKeyHex)
+	if err != nil {
+		return list, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return list, fmt.Errorf("error reading disabledChainsFile: %w", err)
+	}
+	signed := SignedDisabledChainList{}
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return list, fmt.Errorf("error parsing disabledChainsFile %s: %w", path, err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return list, fmt.Errorf("error decoding disabledChainsFile payload: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return list, fmt.Errorf("error decoding disabledChainsFile signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return list, fmt.Errorf("%w: %s", errBadDisabledChainsSignature, path)
+	}
+	if err := json.Unmarshal(payload, &list); err != nil {
+		return list, fmt.Errorf("error parsing disabledChainsFile payload: %w", err)
+	}
+	return list, nil
+}
+
+func parseEd25519PublicKey(publicKeyHex string) (ed25519.PublicKey, error) {
+	publicKey, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding disabledChainsPublicKey: %w", err)
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("disabledChainsPublicKey is %d bytes rather than %d", len(publicKey), ed25519.PublicKeySize)
+	}
+	return publicKey, nil
+}
+
+// ChainEnablement is whether a chain is enabled, and why
+type ChainEnablement struct {
+	Enabled bool
+	Reason  string
+	Source  string // one of the EnablementSource constants
+	Since   int64  // unix seconds
+}
+
+// chainEnablement holds a chain's enablement, which the admin API can change
+// while the chain runs
+type chainEnablement struct {
+	lock    sync.RWMutex
+	current ChainEnablement
+}
+
+func (e *chainEnablement) get() ChainEnablement {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.current
+}
+
+func (e *chainEnablement) set(enablement ChainEnablement) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.current = enablement
+}
+
+// configuredEnablement works out whether chain [chainID] is enabled from the
+// chain config [c] and its disabled chains file
+func configuredEnablement(c ChainConfig, chainID string) (ChainEnablement, error) {
+	now := time.Now().Unix()
+	if !c.Enabled {
+		return ChainEnablement{Reason: "enabled is false in the chain config", Source: EnablementSourceConfig, Since: now}, nil
+	}
+	if c.DisabledChainsFile != "" {
+		list, err := readDisabledChainsFile(c.DisabledChainsFile, c.DisabledChainsPublicKey)
+		if err != nil {
+			return ChainEnablement{}, err
+		}
+		if reason, ok := list.Chains[chainID]; ok {
+			return ChainEnablement{Reason: reason, Source: EnablementSourceFile, Since: now}, nil
+		}
+	}
+	if c.DisabledChains == nil {
+		if reason, ok := builtinDisabledChains[chainID]; ok {
+			return ChainEnablement{Reason: reason, Source: EnablementSourceDefault, Since: now}, nil
+		}
+	} else if reason, ok := c.DisabledChains[chainID]; ok {
+		return ChainEnablement{Reason: reason, Source: EnablementSourceConfig, Since: now}, nil
+	}
+	return ChainEnablement{Enabled: true, Source: EnablementSourceConfig, Since: now}, nil
+}
+
+// Enablement returns whether the chain is enabled, and why
+func (vm *VM) Enablement() ChainEnablement {
+	return vm.enablement.get()
+}
+
+// SetEnabled enables or disables the chain while it runs. A disabled chain
+// stops building blocks and reports unhealthy. The change lasts until the
+// node restarts.
+func (vm *VM) SetEnabled(enabled bool, reason string) {
+	enablement := ChainEnablement{
+		Enabled: enabled,
+		Reason:  reason,
+		Source:  EnablementSourceAdmin,
+		Since:   time.Now().Unix(),
+	}
+	log.Warn("Chain enablement changed by admin", "chain", vm.ctx.ChainID, "enabled", enabled, "reason", reason)
+	vm.enablement.set(enablement)
+	if enabled {
+		vm.NotifyBlockReady()
+	}
+}
+
+// checkEnabled returns an error naming the reason if the chain is disabled
+func (vm *VM) checkEnabled() error {
+	enablement := vm.enablement.get()
+	if enablement.Enabled {
+		return nil
+	}
+	return fmt.Errorf("%w (%s): %s", errChainDisabled, enablement.Source, enablement.Reason)
+}
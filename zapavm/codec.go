@@ -9,8 +9,18 @@ import (
 )
 
 const (
-	// CodecVersion is the current default codec version
-	CodecVersion = 0
+	// legacyCodecVersion is the codec version of blocks whose ZBlk holds
+	// zcashd's JSON-wrapped hex encoding of the zcash block
+	legacyCodecVersion = 0
+
+	// CodecVersion is the current default codec version. Blocks at this
+	// version carry the raw zcash block bytes in ZBlk. Blocks are only built
+	// at this version once UpgradeRawZcashBlocks is active.
+	CodecVersion = 1
+
+	// blkWrapperCodecVersion is the codec version blockState writes
+	// blkWrapper with. Wrappers at lower versions predate the header flags.
+	blkWrapperCodecVersion = 2
 )
 
 // Codecs do serialization and deserialization
@@ -23,8 +33,14 @@ func init() {
 	c := linearcodec.NewDefault()
 	Codec = codec.NewDefaultManager()
 
-	// Register codec to manager with CodecVersion
+	// Register codec to manager with every version we can read
+	if err := Codec.RegisterCodec(legacyCodecVersion, c); err != nil {
+		panic(err)
+	}
 	if err := Codec.RegisterCodec(CodecVersion, c); err != nil {
 		panic(err)
 	}
+	if err := Codec.RegisterCodec(blkWrapperCodecVersion, c); err != nil {
+		panic(err)
+	}
 }
@@ -1,16 +1,18 @@
 package zapavm
 
 import (
+	"bytes"
 	nativejson "encoding/json"
+	"errors"
 	"fmt"
+	"net"
 
 	log "github.com/inconshreveable/log15"
 
-	"io/ioutil"
 	"os"
-	"strconv"
 	"strings"
 
+	"github.com/ava-labs/avalanchego/ids"
 	"github.com/zapalabs/zapavm/zapavm/zclient"
 )
 
@@ -24,25 +26,192 @@ type ChainConfig struct {
 	ZcashPassword string `json:"zcashPassword"`
 	ClearDatabase bool `json:"clearDatabase"`
 	LogLevel string `json:"logLevel"`
+	// compression applied to blocks as they are written to the database.
+	// "none" or "snappy". Blocks already on disk are read whatever their encoding.
+	BlockCompression string `json:"blockCompression"`
+	// when set, accepted blocks more than PruningRetention blocks below the
+	// last accepted block keep only their header. Their zcash block is
+	// fetched from zcashd when needed.
+	Pruning bool `json:"pruning"`
+	PruningRetention uint64 `json:"pruningRetention"`
+	// rejected blocks more than RejectedGCDepth blocks below the last
+	// accepted block are deleted in the background, at most
+	// RejectedGCBatchSize every RejectedGCIntervalSeconds. 0 disables it.
+	RejectedGCDepth uint64 `json:"rejectedGCDepth"`
+	RejectedGCIntervalSeconds int `json:"rejectedGCIntervalSeconds"`
+	RejectedGCBatchSize int `json:"rejectedGCBatchSize"`
+	// when set, pending database migrations are logged rather than applied
+	// and the chain refuses to start until they are run for real
+	MigrationDryRun bool `json:"migrationDryRun"`
+	// enables admin endpoints that change this node's chain, such as setChainEnabled
+	AdminAPIEnabled bool `json:"adminAPIEnabled"`
+	// when set, the chain neither builds nor verifies blocks, so consensus
+	// accepts none and rollbackChain can rewind the chain
+	MaintenanceMode bool `json:"maintenanceMode"`
+	// snapshot archive to provision an empty database from, and the trusted
+	// ID of the snapshot's last accepted block
+	RestoreSnapshot string `json:"restoreSnapshot"`
+	RestoreSnapshotBlockID ids.ID `json:"restoreSnapshotBlockID"`
+	// zcashd each node of a multi-node setup uses, keyed by NodeID, inline
+	// and from a JSON file in the same format. Checked before avasim.
+	ZcashNodes     ZcashNodes `json:"zcashNodes"`
+	ZcashNodesFile string     `json:"zcashNodesFile"`
+	// chains that don't build blocks, mapped to why. Replaces the built-in
+	// list of disabled chains when set.
+	DisabledChains map[string]string `json:"disabledChains"`
+	// signed disabled chains file, checked against the hex ed25519
+	// DisabledChainsPublicKey
+	DisabledChainsFile      string `json:"disabledChainsFile"`
+	DisabledChainsPublicKey string `json:"disabledChainsPublicKey"`
+	// EnvironmentProduction or EnvironmentTest. Defaults to production on
+	// mainnet and test elsewhere.
+	Environment string `json:"environment"`
+	// bearer tokens API callers authenticate with, and their roles
+	APITokens []APIToken `json:"apiTokens"`
+	// which zcashd methods zcashrpc forwards, over the read-only defaults
+	ZcashRPC ZcashRPCConfig `json:"zcashRPC"`
+	// URLs events are POSTed to. More can be added through the admin API.
+	Webhooks []Webhook `json:"webhooks"`
 }
 
-func NewChainConfig(conf []byte) ChainConfig {
-	cconf := ChainConfig{
-		Enabled: true,
-		MockZcash: false,
-		LogLevel: log.LvlInfo.String(),
+// redacted replaces secrets in configs returned by Redacted
+const redacted = "[redacted]"
+
+var errInvalidChainConfig = errors.New("invalid chain config")
+
+// DefaultChainConfig returns the config used for keys a chain config leaves out
+func DefaultChainConfig() ChainConfig {
+	return ChainConfig{
+		Enabled:                   true,
+		MockZcash:                 false,
+		LogLevel:                  log.LvlInfo.String(),
+		BlockCompression:          CompressionNone,
+		PruningRetention:          defaultPruningRetention,
+		RejectedGCDepth:           defaultRejectedGCDepth,
+		RejectedGCIntervalSeconds: defaultRejectedGCIntervalSeconds,
+		RejectedGCBatchSize:       defaultRejectedGCBatchSize,
 	}
+}
+
+// NewChainConfig parses the chain config JSON [conf] over the defaults.
+// Unknown keys are rejected and the result is validated, reporting every
+// problem found.
+func NewChainConfig(conf []byte) (ChainConfig, error) {
+	cconf := DefaultChainConfig()
 	as := os.Getenv("AVASIM")
 	if as != "" {
 		log.Info("Running as part of local ava-sim environment")
 		cconf.AvaSim = true
 	}
-	jsonerr := nativejson.Unmarshal(conf, &cconf)
-	if jsonerr != nil {
-		log.Warn("Error initializing config, returning default config")
-		log.Debug("Config initialization error", "error", jsonerr)
+	if len(bytes.TrimSpace(conf)) > 0 {
+		dec := nativejson.NewDecoder(bytes.NewReader(conf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cconf); err != nil {
+			return cconf, fmt.Errorf("%w: %s", errInvalidChainConfig, err)
+		}
+		if dec.More() {
+			return cconf, fmt.Errorf("%w: unexpected data after the config object", errInvalidChainConfig)
+		}
+	}
+	return cconf, cconf.Validate()
+}
+
+// Validate checks the config's values, reporting every problem found
+func (c ChainConfig) Validate() error {
+	var problems []string
+	if _, err := log.LvlFromString(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("logLevel %q isn't one of crit, error, warn, info, debug or trace", c.LogLevel))
+	}
+	if _, err := compressionFlags(c.BlockCompression); err != nil {
+		problems = append(problems, fmt.Sprintf("blockCompression: %s", err))
+	}
+	if c.ZcashHost != "" && !validHost(c.ZcashHost) {
+		problems = append(problems, fmt.Sprintf("zcashHost %q isn't a hostname or IP address", c.ZcashHost))
+	}
+	if c.ZcashPort < 1 || c.ZcashPort > 65535 {
+		problems = append(problems, fmt.Sprintf("zcashPort %d isn't between 1 and 65535", c.ZcashPort))
+	}
+	if c.MockZcash && c.AvaSim {
+		problems = append(problems, "mockZcash and avasim can't both be set")
+	}
+	if c.Environment != "" && c.Environment != EnvironmentProduction && c.Environment != EnvironmentTest {
+		problems = append(problems, fmt.Sprintf("environment %q isn't %q or %q", c.Environment, EnvironmentProduction, EnvironmentTest))
+	}
+	problems = append(problems, c.ZcashNodes.problems("zcashNodes")...)
+	problems = append(problems, apiTokenProblems(c.APITokens)...)
+	problems = append(problems, c.ZcashRPC.problems("zcashRPC")...)
+	problems = append(problems, webhooksProblems(c.Webhooks)...)
+	for chainID := range c.DisabledChains {
+		if _, err := ids.FromString(chainID); err != nil {
+			problems = append(problems, fmt.Sprintf("disabledChains: %q isn't a chain ID", chainID))
+		}
+	}
+	if c.DisabledChainsFile != "" {
+		if c.DisabledChainsPublicKey == "" {
+			problems = append(problems, "disabledChainsPublicKey is required with disabledChainsFile")
+		} else if _, err := parseEd25519PublicKey(c.DisabledChainsPublicKey); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.Pruning && c.PruningRetention == 0 {
+		problems = append(problems, "pruningRetention must be positive when pruning")
+	}
+	if err := checkRejectedGCConfig(c); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.RestoreSnapshot != "" && c.RestoreSnapshotBlockID == ids.Empty {
+		problems = append(problems, "restoreSnapshotBlockID is required with restoreSnapshot")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", errInvalidChainConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validHost returns whether [host] is an IP address or a DNS hostname
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
 	}
-	return cconf
+	return true
+}
+
+// Redacted returns the config with secrets replaced, for logs and APIs
+func (c ChainConfig) Redacted() ChainConfig {
+	if c.ZcashPassword != "" {
+		c.ZcashPassword = redacted
+	}
+	c.ZcashNodes = c.ZcashNodes.redacted()
+	if c.APITokens != nil {
+		tokens := make([]APIToken, len(c.APITokens))
+		for i, token := range c.APITokens {
+			token.Token = redacted
+			tokens[i] = token
+		}
+		c.APITokens = tokens
+	}
+	if c.Webhooks != nil {
+		hooks := make([]Webhook, len(c.Webhooks))
+		for i, hook := range c.Webhooks {
+			hook.Secret = redacted
+			hooks[i] = hook
+		}
+		c.Webhooks = hooks
+	}
+	return c
 }
 
 func (c *ChainConfig) ZcashClient(nodeID string) (zclient.ZcashClient, error) {
@@ -50,31 +219,26 @@ func (c *ChainConfig) ZcashClient(nodeID string) (zclient.ZcashClient, error) {
 		log.Info("Initializing mock zcash client")
 		return zclient.NewDefaultMock(), nil
 	}
-	if c.AvaSim {
+	endpoint, mapped, err := c.zcashNodeEndpoint(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if !mapped && c.AvaSim {
 		log.Info("Initializing local node config by examining ~/node-ids/ directory")
-		i := 0
-		h, _ := os.LookupEnv("HOME")
-		for i < 6 {
-			// examine each file in ~/node-ids/ dir. is the file name
-			// equal to our node id? if so, we assume that node number.
-			// once we know our node number our zcash port becomes known
-			fname := h + "/node-ids/" + strconv.Itoa(i)
-			nid, _ := ioutil.ReadFile(fname)
-			snid := strings.ReplaceAll(string(nid), "NodeID-", "")
-			if snid == nodeID {
-				port := 8233 + i + 1
-				log.Info("Initializing zcash client", "node number", i, "zcash port", port)
-				return &zclient.ZcashHTTPClient {
-					Host: "127.0.0.1",
-					Port: port,
-					User: "test",
-					Password: "pw",
-				}, nil
-			}
-			i += 1
+		if endpoint, err = avaSimEndpoint(nodeID); err != nil {
+			return nil, err
 		}
-		return &zclient.ZcashHTTPClient{}, fmt.Errorf("Unable to initialize node config from reading ~/node-ids directory")
+		mapped = true
+	}
+	if mapped {
+		return &zclient.ZcashHTTPClient{
+			Host:     firstNonEmpty(endpoint.Host, c.ZcashHost),
+			Port:     firstNonZero(endpoint.Port, c.ZcashPort),
+			User:     firstNonEmpty(endpoint.User, c.ZcashUser),
+			Password: firstNonEmpty(endpoint.Password, c.ZcashPassword),
+		}, nil
 	}
+	log.Info("Using zcashd from the chain config", "host", c.ZcashHost, "port", c.ZcashPort)
 	return &zclient.ZcashHTTPClient{
 		Host: c.ZcashHost,
 		Port: c.ZcashPort,
@@ -82,3 +246,17 @@ func (c *ChainConfig) ZcashClient(nodeID string) (zclient.ZcashClient, error) {
 		Password: c.ZcashPassword,
 	}, nil
 }
+
+func firstNonEmpty(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+func firstNonZero(i, fallback int) int {
+	if i != 0 {
+		return i
+	}
+	return fallback
+}
@@ -0,0 +1,68 @@
+package zapavm
+
+import (
+	"net/http"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+// DebugService is the API service of nodes in test environments: Service
+// plus endpoints that spend from zcashd's wallet, mine on demand, pass calls
+// straight through to zcashd or repoint the zcash client. Production nodes
+// don't serve them.
+type DebugService struct{ *Service }
+
+// sends funds from this node's zcash wallet, which makes it a faucet
+func (s *DebugService) SubmitTx(_ *http.Request, args *SubmitTxArgs, reply *GetMempoolReply) error {
+	log.Debug("SubmitTx: begin", "from", args.From, "to", args.To, "amount", args.Amount)
+	for _, address := range []string{args.From, args.To} {
+		if err := checkZcashAddress(address, s.vm.zcashNetwork); err != nil {
+			return err
+		}
+	}
+	result := s.vm.zc.SendMany(args.From, args.To, args.Amount)
+	if result.Error != nil {
+		return result.Error.Error()
+	} else {
+		s.vm.as.SendAppGossip(result.Result)
+		s.vm.publishTx(TxSourceLocal, "", result.Result)
+		s.vm.NotifyBlockReady()
+		reply.SubmittedTx = result.Result
+		reply.Mempool = nil
+	}
+	return nil
+}
+
+// tells the vm to mine a new block. will usually (but not 100%) cause this node to mine
+func (s *DebugService) MineBlock(_ *http.Request, args *EmptyArgs, reply *SuccessReply) error {
+	log.Debug("MineBlock: begin")
+	s.vm.NotifyBlockReady()
+	reply.Success = true
+	return nil
+}
+
+func (s *DebugService) Zcashrpc(_ *http.Request, args *zclient.ZCashRequest, reply *zclient.ZCashResponse) error {
+	log.Debug("Zcashrpc: begin", "method", args.Method)
+	if err := s.vm.zcashRPCPolicy.Check(args.Method, args.Params); err != nil {
+		log.Warn("Denied zcashrpc call", "method", args.Method, "params", len(args.Params), "err", err)
+		return err
+	}
+	result := s.vm.zc.CallZcashJson(args.Method, args.Params)
+	reply.Result = result.Result
+	reply.ID = result.ID
+	reply.Error = result.Error
+	if reply.Error != nil {
+		return reply.Error.Error()
+	}
+	return nil
+}
+
+// associate with new zcash host and port
+func (s *DebugService) AssociateZcashHostPort(_ *http.Request, args *ZcashHostInfo, reply *SuccessReply) error {
+	log.Debug("AssociateZcashHostPort: begin", "rpc host", args.Host, "rpc port", args.Port)
+	s.vm.zc.SetHost(args.Host)
+	s.vm.zc.SetPort(args.Port)
+	reply.Success = true
+	return nil
+}
@@ -0,0 +1,79 @@
+package zapavm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/utils/constants"
+)
+
+// environments a node can run in. Debug endpoints such as mineBlock and
+// zcashrpc are only served in test environments.
+const (
+	EnvironmentProduction = "production"
+	EnvironmentTest       = "test"
+)
+
+var errWrongZcashNetwork = errors.New("address belongs to another zcash network")
+
+// environmentFor works out the environment of a node on avalanche network
+// [networkID] with chain config environment [configured], which may be empty
+// to pick the network's default: production on mainnet, test elsewhere.
+// Mainnet can't be configured as a test environment.
+func environmentFor(networkID uint32, configured string) (string, error) {
+	switch configured {
+	case "":
+		if networkID == constants.MainnetID {
+			return EnvironmentProduction, nil
+		}
+		return EnvironmentTest, nil
+	case EnvironmentProduction:
+		return EnvironmentProduction, nil
+	case EnvironmentTest:
+		if networkID == constants.MainnetID {
+			return "", fmt.Errorf("environment %q isn't allowed on %s", EnvironmentTest, constants.NetworkName(networkID))
+		}
+		return EnvironmentTest, nil
+	default:
+		return "", fmt.Errorf("unknown environment %q, expected %q or %q", configured, EnvironmentProduction, EnvironmentTest)
+	}
+}
+
+// zcashAddressPrefixes maps the prefixes of zcash transparent, sapling and
+// unified addresses to the networks that use them. Sprout addresses aren't
+// listed since their testnet prefix is ambiguous.
+var zcashAddressPrefixes = map[string][]string{
+	"t1":               {"main"},
+	"t3":               {"main"},
+	"zs1":              {"main"},
+	"u1":               {"main"},
+	"tm":               {"test", "regtest"},
+	"t2":               {"test", "regtest"},
+	"ztestsapling1":    {"test"},
+	"utest1":           {"test"},
+	"zregtestsapling1": {"regtest"},
+	"uregtest1":        {"regtest"},
+}
+
+// checkZcashAddress returns an error if [address] has the prefix of a zcash
+// network other than [network]. Addresses with no known prefix are left to
+// zcashd to validate.
+func checkZcashAddress(address string, network string) error {
+	longest := ""
+	for prefix := range zcashAddressPrefixes {
+		if strings.HasPrefix(address, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return nil
+	}
+	networks := zcashAddressPrefixes[longest]
+	for _, n := range networks {
+		if n == network {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is a %s address but zcashd runs %s", errWrongZcashNetwork, address, strings.Join(networks, "/"), network)
+}
@@ -0,0 +1,479 @@
+package zapavm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	// events buffered per connection before it's dropped for falling behind
+	eventBufferSize = 1024
+	// heights read from the database per lock when replaying events
+	eventReplayBatch = 256
+	// most operations a client can track at once, across its connections
+	maxTrackedOperations = 64
+	// most event streams open at once, and per client. Clients are told
+	// apart by API token, or by IP address without one.
+	maxEventStreams          = 256
+	maxEventStreamsPerClient = 8
+	// largest message clients can send
+	maxSubscribeRequestSize = 64 * 1024
+
+	eventWriteTimeout     = 10 * time.Second
+	eventPingInterval     = 30 * time.Second
+	operationPollInterval = 2 * time.Second
+)
+
+// types of the messages sent over an event stream that aren't events
+const (
+	NoticeSubscribed = "subscribed"
+	NoticeError      = "error"
+)
+
+var (
+	errEventStreamShutdown = errors.New("VM is shutting down")
+	errTooManyStreams      = errors.New("too many event streams")
+)
+
+// eventRoles maps event types to the role needed to subscribe to them.
+// Event types that aren't listed are public.
+var eventRoles = map[string]string{
+	// operations belong to the wallet of this node's zcashd
+	EventOperation: RoleAdmin,
+}
+
+// SubscribeRequest is what clients send over the event stream to set which
+// events they receive. Each request replaces the previous one.
+type SubscribeRequest struct {
+	Events []string `json:"events"`
+	// replay accepted and rejected blocks from this height before sending
+	// new ones, to resume after a reconnect
+	FromHeight *uint64 `json:"fromHeight,omitempty"`
+	// IDs of zcashd async operations to send operation events for
+	Operations []string `json:"operations,omitempty"`
+}
+
+// StreamNotice is sent over the event stream when a subscription is set or
+// a request fails
+type StreamNotice struct {
+	Type    string   `json:"type"`
+	Events  []string `json:"events,omitempty"`
+	Height  *uint64  `json:"height,omitempty"` // last height replayed
+	Message string   `json:"message,omitempty"`
+}
+
+// eventStreamHandler serves event subscriptions over WebSocket
+type eventStreamHandler struct {
+	vm       *VM
+	upgrader websocket.Upgrader
+
+	// open streams and tracked operations, in total and by client
+	lock    sync.Mutex
+	streams int
+	clients map[string]*eventClient
+}
+
+// eventClient is what one client has open
+type eventClient struct {
+	streams    int
+	operations int
+}
+
+func newEventStreamHandler(vm *VM) *eventStreamHandler {
+	return &eventStreamHandler{vm: vm, clients: make(map[string]*eventClient)}
+}
+
+func (h *eventStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller := requestCaller(r)
+	client := streamClient(r, caller)
+	if err := h.open(client); err != nil {
+		log.Debug("Refused event stream", "remote", r.RemoteAddr, "client", client, "error", err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer h.closeStream(client)
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an error
+		log.Debug("Error upgrading event stream", "remote", r.RemoteAddr, "error", err)
+		return
+	}
+	conn.SetReadLimit(maxSubscribeRequestSize)
+	log.Debug("Opened event stream", "remote", r.RemoteAddr, "client", client)
+
+	stream := &eventStream{
+		vm:         h.vm,
+		handler:    h,
+		client:     client,
+		role:       callerRole(caller),
+		conn:       conn,
+		sub:        h.vm.events.subscribe(eventBufferSize),
+		filter:     make(map[string]bool),
+		operations: make(map[string]string),
+	}
+	err = stream.run()
+	h.untrackOperations(client, len(stream.operations))
+	log.Debug("Closed event stream", "remote", r.RemoteAddr, "client", client, "error", err)
+}
+
+// streamClient identifies who opened [r]: the name of its API token, or its
+// IP address without one
+func streamClient(r *http.Request, caller *APIToken) string {
+	if caller != nil {
+		return "token:" + caller.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// open counts a new stream of [client], unless that would go over the caps
+func (h *eventStreamHandler) open(client string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	c, ok := h.clients[client]
+	if !ok {
+		c = &eventClient{}
+	}
+	switch {
+	case h.streams >= maxEventStreams:
+		return fmt.Errorf("%w: the node serves at most %d", errTooManyStreams, maxEventStreams)
+	case c.streams >= maxEventStreamsPerClient:
+		return fmt.Errorf("%w: at most %d can be open per client", errTooManyStreams, maxEventStreamsPerClient)
+	}
+	h.streams++
+	c.streams++
+	h.clients[client] = c
+	return nil
+}
+
+// closeStream stops counting a stream of [client]
+func (h *eventStreamHandler) closeStream(client string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.streams--
+	c := h.clients[client]
+	c.streams--
+	if c.streams == 0 {
+		delete(h.clients, client)
+	}
+}
+
+// trackOperations changes the number of operations [client] tracks by
+// [delta], unless that would go over maxTrackedOperations
+func (h *eventStreamHandler) trackOperations(client string, delta int) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	c := h.clients[client]
+	if c.operations+delta > maxTrackedOperations {
+		return fmt.Errorf("at most %d operations can be tracked per client, and %d already are", maxTrackedOperations, c.operations)
+	}
+	c.operations += delta
+	return nil
+}
+
+// untrackOperations stops counting [n] operations [client] tracked
+func (h *eventStreamHandler) untrackOperations(client string, n int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.clients[client].operations -= n
+}
+
+// eventStream is one client's connection
+type eventStream struct {
+	vm      *VM
+	handler *eventStreamHandler
+	client  string
+	role    string // role of the token the stream was opened with
+	conn    *websocket.Conn
+	sub     *subscription
+
+	filter map[string]bool
+	// tracked operation IDs, mapped to the last status sent
+	operations map[string]string
+	// last height replayed. Live block events at or below it were sent
+	// by the replay.
+	replayedTo *uint64
+}
+
+// streamRequest is a message read from the client
+type streamRequest struct {
+	req SubscribeRequest
+	err error
+}
+
+func (s *eventStream) run() error {
+	defer s.conn.Close()
+	defer s.vm.events.unsubscribe(s.sub)
+
+	done := make(chan struct{})
+	defer close(done)
+	requests := make(chan streamRequest)
+	readErr := make(chan error, 1)
+	go s.readRequests(requests, readErr, done)
+
+	poll := time.NewTicker(operationPollInterval)
+	defer poll.Stop()
+	ping := time.NewTicker(eventPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-s.vm.shutdownChan:
+			s.close(websocket.CloseGoingAway, "node is shutting down")
+			return errEventStreamShutdown
+		case <-s.sub.dropped:
+			s.close(websocket.CloseTryAgainLater, "subscription fell behind, reconnect with fromHeight")
+			return errors.New("subscription fell behind")
+		case err = <-readErr:
+			return err
+		case r := <-requests:
+			if r.err != nil {
+				err = s.notice(StreamNotice{Type: NoticeError, Message: r.err.Error()})
+			} else {
+				err = s.setSubscription(r.req)
+			}
+		case event := <-s.sub.events:
+			err = s.sendLive(event)
+		case <-poll.C:
+			err = s.pollOperations()
+		case <-ping.C:
+			err = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readRequests reads subscribe requests until the connection fails
+func (s *eventStream) readRequests(requests chan<- streamRequest, readErr chan<- error, done <-chan struct{}) {
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			readErr <- err
+			return
+		}
+		var r streamRequest
+		if err := json.Unmarshal(msg, &r.req); err != nil {
+			r.err = fmt.Errorf("invalid subscribe request: %w", err)
+		}
+		select {
+		case requests <- r:
+		case <-done:
+			return
+		}
+	}
+}
+
+// setSubscription applies [req], replaying blocks first if it asks to
+func (s *eventStream) setSubscription(req SubscribeRequest) error {
+	filter := make(map[string]bool, len(req.Events))
+	for _, eventType := range req.Events {
+		if !eventTypes[eventType] {
+			return s.notice(StreamNotice{Type: NoticeError, Message: fmt.Sprintf("unknown event %q", eventType)})
+		}
+		if required, ok := eventRoles[eventType]; ok && roleRank[s.role] < roleRank[required] {
+			return s.notice(StreamNotice{Type: NoticeError, Message: fmt.Sprintf("%s events require the %s role: connect with an API token", eventType, required)})
+		}
+		filter[eventType] = true
+	}
+	if len(req.Operations) > 0 && !filter[EventOperation] {
+		return s.notice(StreamNotice{Type: NoticeError, Message: fmt.Sprintf("operations can only be tracked with %s events", EventOperation)})
+	}
+	operations := make(map[string]string, len(req.Operations))
+	for _, id := range req.Operations {
+		operations[id] = s.operations[id]
+	}
+	if err := s.handler.trackOperations(s.client, len(operations)-len(s.operations)); err != nil {
+		return s.notice(StreamNotice{Type: NoticeError, Message: err.Error()})
+	}
+	s.filter = filter
+	s.operations = operations
+	s.replayedTo = nil
+
+	if req.FromHeight != nil {
+		if err := s.replay(*req.FromHeight); err != nil {
+			return err
+		}
+	}
+	events := make([]string, 0, len(filter))
+	for eventType := range filter {
+		events = append(events, eventType)
+	}
+	sort.Strings(events)
+	return s.notice(StreamNotice{Type: NoticeSubscribed, Events: events, Height: s.replayedTo})
+}
+
+// replay sends the subscribed block events from height [from] up to the
+// last accepted block
+func (s *eventStream) replay(from uint64) error {
+	if !s.filter[EventBlockAccepted] && !s.filter[EventBlockRejected] {
+		return nil
+	}
+	for {
+		events, tip, err := s.replayBatch(from)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := s.write(event); err != nil {
+				return err
+			}
+		}
+		from += eventReplayBatch
+		if from > tip {
+			s.replayedTo = &tip
+			return nil
+		}
+	}
+}
+
+// replayBatch reads the block events of the heights from [from] in one
+// batch, and returns them with the height of the last accepted block
+func (s *eventStream) replayBatch(from uint64) ([]Event, uint64, error) {
+	s.vm.ctx.Lock.Lock()
+	defer s.vm.ctx.Lock.Unlock()
+
+	// Shutdown may have closed the database while we waited for the lock
+	if s.vm.isShutdown() {
+		return nil, 0, errEventStreamShutdown
+	}
+	lastAccepted, err := s.vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	tip := lastAccepted.Height()
+	if from > tip {
+		return nil, tip, nil
+	}
+	to := from + eventReplayBatch
+	if to > tip+1 {
+		to = tip + 1
+	}
+
+	rejected := make(map[uint64][]RejectedBlockInfo)
+	if s.filter[EventBlockRejected] {
+		infos, err := s.vm.state.GetRejectedBlocks(from, to, math.MaxInt32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading rejected index: %w", err)
+		}
+		for _, info := range infos {
+			rejected[info.Height] = append(rejected[info.Height], info)
+		}
+	}
+	var events []Event
+	for height := from; height < to; height++ {
+		if s.filter[EventBlockAccepted] {
+			block, err := s.vm.GetBlockAtHeight(height)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error retrieving block at height %d: %w", height, err)
+			}
+			events = append(events, Event{Type: EventBlockAccepted, Block: blockEvent(block), Replayed: true})
+		}
+		for _, info := range rejected[height] {
+			events = append(events, Event{Type: EventBlockRejected, Block: rejectedBlockEvent(info), Replayed: true})
+		}
+	}
+	return events, tip, nil
+}
+
+// sendLive sends [event] from the bus if the client subscribed to it and
+// the replay hasn't already sent it
+func (s *eventStream) sendLive(event Event) error {
+	if !s.filter[event.Type] {
+		return nil
+	}
+	if event.Block != nil && s.replayedTo != nil && event.Block.Height <= *s.replayedTo {
+		return nil
+	}
+	return s.write(event)
+}
+
+// pollOperations sends an operation event for each tracked operation whose
+// status changed, and stops tracking those that finished
+func (s *eventStream) pollOperations() error {
+	if !s.filter[EventOperation] || len(s.operations) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(s.operations))
+	for id := range s.operations {
+		ids = append(ids, id)
+	}
+	params := []interface{}{ids}
+	// the zcashrpc policy may deny the method zcashd is polled with
+	if err := s.vm.zcashRPCPolicy.Check("z_getoperationstatus", params); err != nil {
+		s.handler.untrackOperations(s.client, len(s.operations))
+		s.operations = make(map[string]string)
+		return s.notice(StreamNotice{Type: NoticeError, Message: err.Error()})
+	}
+
+	// zcashd is called without the context lock, so a slow zcashd doesn't
+	// stall consensus
+	s.vm.ctx.Lock.Lock()
+	zc := s.vm.zc
+	s.vm.ctx.Lock.Unlock()
+	resp := zc.CallZcashJson("z_getoperationstatus", params)
+	if resp.Error != nil {
+		// zcashd may be briefly unavailable; try again on the next poll
+		log.Debug("Error polling operation status", "error", resp.Error.Message)
+		return nil
+	}
+	var statuses []OperationEvent
+	if err := json.Unmarshal(resp.Result, &statuses); err != nil {
+		log.Debug("Error decoding operation status", "error", err)
+		return nil
+	}
+	for i := range statuses {
+		op := statuses[i]
+		last, tracked := s.operations[op.ID]
+		if !tracked || last == op.Status {
+			continue
+		}
+		if err := s.write(Event{Type: EventOperation, Operation: &op}); err != nil {
+			return err
+		}
+		if op.done() {
+			delete(s.operations, op.ID)
+			s.handler.untrackOperations(s.client, 1)
+		} else {
+			s.operations[op.ID] = op.Status
+		}
+	}
+	return nil
+}
+
+func (s *eventStream) notice(notice StreamNotice) error {
+	return s.write(notice)
+}
+
+func (s *eventStream) write(v interface{}) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+		return err
+	}
+	return s.conn.WriteJSON(v)
+}
+
+// close tells the client why the stream is closing
+func (s *eventStream) close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(eventWriteTimeout))
+}
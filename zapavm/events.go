@@ -0,0 +1,187 @@
+package zapavm
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ava-labs/avalanchego/ids"
+	log "github.com/inconshreveable/log15"
+)
+
+// types of events clients can subscribe to
+const (
+	EventBlockAccepted = "blockAccepted"
+	EventBlockRejected = "blockRejected"
+	EventMempoolTx     = "mempoolTx"
+	EventOperation     = "operation"
+)
+
+// where the transactions of mempoolTx events came from
+const (
+	TxSourceLocal  = "local"  // submitted through this node's submitTx
+	TxSourceGossip = "gossip" // gossiped by another node
+)
+
+// eventTypes are the types of events clients can subscribe to
+var eventTypes = map[string]bool{
+	EventBlockAccepted: true,
+	EventBlockRejected: true,
+	EventMempoolTx:     true,
+	EventOperation:     true,
+}
+
+// Event is a notification sent to subscribers. Exactly one of Block, Tx and
+// Operation is set, depending on Type.
+type Event struct {
+	Type      string          `json:"type"`
+	Block     *BlockEvent     `json:"block,omitempty"`
+	Tx        *TxEvent        `json:"tx,omitempty"`
+	Operation *OperationEvent `json:"operation,omitempty"`
+	// whether the event was read back from the database to resume a
+	// subscription rather than sent as it happened
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// BlockEvent describes an accepted or rejected block
+type BlockEvent struct {
+	ID            ids.ID `json:"id"`
+	ParentID      ids.ID `json:"parentID"`
+	Height        uint64 `json:"height"`
+	CreationTime  int64  `json:"creationTime"`
+	ProducingNode string `json:"producingNode"`
+	// hash of the zcash block, as zcashd displays it. Empty for rejected
+	// blocks replayed after the collector deleted them.
+	ZcashHash string `json:"zcashHash,omitempty"`
+}
+
+// TxEvent describes a transaction added to zcashd's mempool
+type TxEvent struct {
+	Source string `json:"source"`           // TxSourceLocal or TxSourceGossip
+	NodeID string `json:"nodeID,omitempty"` // node that gossiped the transaction
+	// the transaction as z_sendmany returned it and nodes gossip it
+	Tx json.RawMessage `json:"tx"`
+}
+
+// OperationEvent is the status of a zcashd async operation, such as a
+// z_sendmany, sent each time it changes
+type OperationEvent struct {
+	ID           string          `json:"id"`
+	Status       string          `json:"status"` // queued, executing, success, failed or cancelled
+	Method       string          `json:"method,omitempty"`
+	CreationTime int64           `json:"creation_time,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        json.RawMessage `json:"error,omitempty"`
+}
+
+// done returns whether the operation has finished and won't change again
+func (o OperationEvent) done() bool {
+	switch o.Status {
+	case "success", "failed", "cancelled":
+		return true
+	default:
+		return false
+	}
+}
+
+func blockEvent(b *Block) *BlockEvent {
+	event := &BlockEvent{
+		ID:            b.ID(),
+		ParentID:      b.Parent(),
+		Height:        b.Height(),
+		CreationTime:  b.CreationTime,
+		ProducingNode: b.ProducingNode,
+	}
+	if zhash, err := b.ZcashHash(); err == nil {
+		event.ZcashHash = zhash
+	}
+	return event
+}
+
+func rejectedBlockEvent(info RejectedBlockInfo) *BlockEvent {
+	return &BlockEvent{
+		ID:            info.ID,
+		ParentID:      info.ParentID,
+		Height:        info.Height,
+		CreationTime:  info.CreationTime,
+		ProducingNode: info.ProducingNode,
+	}
+}
+
+// subscription receives the events published on an eventBus
+type subscription struct {
+	id     uint64
+	events chan Event
+	// closed when the bus drops the subscription because it fell too far
+	// behind. The subscriber should resume from the last height it saw.
+	dropped chan struct{}
+}
+
+// eventBus fans events out to subscriptions. Publishing never blocks: a
+// subscription whose buffer is full is dropped instead.
+type eventBus struct {
+	lock          sync.Mutex
+	nextID        uint64
+	subscriptions map[uint64]*subscription
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscriptions: make(map[uint64]*subscription)}
+}
+
+// subscribe returns a subscription that buffers up to [buffer] events
+func (e *eventBus) subscribe(buffer int) *subscription {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.nextID++
+	sub := &subscription{
+		id:      e.nextID,
+		events:  make(chan Event, buffer),
+		dropped: make(chan struct{}),
+	}
+	e.subscriptions[sub.id] = sub
+	return sub
+}
+
+// unsubscribe stops sending events to [sub]
+func (e *eventBus) unsubscribe(sub *subscription) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	delete(e.subscriptions, sub.id)
+}
+
+// publish sends [event] to every subscription
+func (e *eventBus) publish(event Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for id, sub := range e.subscriptions {
+		select {
+		case sub.events <- event:
+		default:
+			log.Warn("Dropping event subscription that fell behind", "subscription", id, "event", event.Type)
+			close(sub.dropped)
+			delete(e.subscriptions, id)
+		}
+	}
+}
+
+// publishBlock notifies subscribers and webhooks that [b] was accepted or rejected
+func (vm *VM) publishBlock(eventType string, b *Block) {
+	event := Event{Type: eventType, Block: blockEvent(b)}
+	vm.events.publish(event)
+	// webhooks start after the initial sync, so it doesn't flood them
+	if vm.webhooks != nil {
+		vm.webhooks.enqueue(event)
+	}
+}
+
+// publishTx notifies subscribers that [tx] was added to zcashd's mempool
+func (vm *VM) publishTx(source string, nodeID string, tx []byte) {
+	if !json.Valid(tx) {
+		log.Debug("Not publishing transaction that isn't valid JSON", "source", source, "nodeID", nodeID)
+		return
+	}
+	vm.events.publish(Event{Type: EventMempoolTx, Tx: &TxEvent{Source: source, NodeID: nodeID, Tx: tx}})
+}
@@ -0,0 +1,242 @@
+package zapavm
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	ExportFormatJSONL = "jsonl"
+	ExportFormatCSV   = "csv"
+
+	// number of blocks imported between progress logs and commits
+	importCommitInterval = 10000
+	// longest JSONL line an import accepts
+	maxImportLineSize = 64 * 1024 * 1024
+)
+
+var exportCSVHeader = []string{"id", "parentID", "height", "timestamp", "producingNode", "status", "zblock", "bytes"}
+
+// ExportOptions selects what ExportChain writes
+type ExportOptions struct {
+	Format     string // ExportFormatJSONL or ExportFormatCSV
+	FromHeight uint64 // inclusive
+	ToHeight   uint64 // exclusive. Zero exports through the last accepted block
+	// also write each block's zcash block and encoded bytes, which an
+	// import needs
+	IncludeZBlock bool
+}
+
+// ExportedBlock is a row of a chain export. ZBlock and Bytes are hex and
+// only set when the export includes zcash blocks.
+type ExportedBlock struct {
+	ID            ids.ID `json:"id"`
+	ParentID      ids.ID `json:"parentID"`
+	Height        uint64 `json:"height"`
+	Timestamp     int64  `json:"timestamp"`
+	ProducingNode string `json:"producingNode"`
+	Status        string `json:"status"`
+	ZBlock        string `json:"zblock,omitempty"`
+	Bytes         string `json:"bytes,omitempty"`
+}
+
+// ExportChain streams accepted blocks in [opts]' height range to [w], in
+// height order, and returns how many it wrote
+func (vm *VM) ExportChain(w io.Writer, opts ExportOptions) (uint64, error) {
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return 0, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	to := lastAccepted.Height() + 1
+	if opts.ToHeight != 0 && opts.ToHeight < to {
+		to = opts.ToHeight
+	}
+
+	bw := bufio.NewWriter(w)
+	var write func(ExportedBlock) error
+	switch opts.Format {
+	case ExportFormatJSONL:
+		enc := json.NewEncoder(bw)
+		write = func(row ExportedBlock) error { return enc.Encode(row) }
+	case ExportFormatCSV:
+		cw := csv.NewWriter(bw)
+		header := exportCSVHeader
+		if !opts.IncludeZBlock {
+			header = header[:len(header)-2]
+		}
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+		write = func(row ExportedBlock) error {
+			record := []string{
+				row.ID.String(),
+				row.ParentID.String(),
+				strconv.FormatUint(row.Height, 10),
+				strconv.FormatInt(row.Timestamp, 10),
+				row.ProducingNode,
+				row.Status,
+			}
+			if opts.IncludeZBlock {
+				record = append(record, row.ZBlock, row.Bytes)
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unknown export format %q, expected %q or %q", opts.Format, ExportFormatJSONL, ExportFormatCSV)
+	}
+
+	written := uint64(0)
+	for height := opts.FromHeight; height < to; height++ {
+		blk, err := vm.GetBlockAtHeight(height)
+		if err != nil {
+			return written, err
+		}
+		row, err := ExportBlock(blk, opts.IncludeZBlock)
+		if err != nil {
+			return written, err
+		}
+		if err := write(row); err != nil {
+			return written, fmt.Errorf("error writing block at height %d: %w", height, err)
+		}
+		written++
+	}
+	return written, bw.Flush()
+}
+
+// ExportBlock returns [blk] as a row of an export
+func ExportBlock(blk *Block, includeZBlock bool) (ExportedBlock, error) {
+	row := ExportedBlock{
+		ID:            blk.ID(),
+		ParentID:      blk.Parent(),
+		Height:        blk.Height(),
+		Timestamp:     blk.CreationTime,
+		ProducingNode: blk.ProducingNode,
+		Status:        blk.Status().String(),
+	}
+	if includeZBlock {
+		bytes, err := blk.LoadBytes()
+		if err != nil {
+			return row, fmt.Errorf("error loading block at height %d: %w", blk.Height(), err)
+		}
+		row.ZBlock = hex.EncodeToString(blk.ZBlock())
+		row.Bytes = hex.EncodeToString(bytes)
+	}
+	return row, nil
+}
+
+// ImportChain loads a JSONL export that includes zcash blocks into the empty
+// database [db] of chain [chainID]. The export must start at genesis. Each
+// block must hash to its ID and link to the block before it. Secondary
+// indexes are left to the migrations, which rebuild them the first time the
+// node starts on the database. Returns the last imported block.
+func ImportChain(db database.Database, chainID ids.ID, r io.Reader, conf ChainConfig) (*Block, error) {
+	// nothing is fetched from zcashd, as every block comes with its bytes
+	vm := newOfflineVM(db, chainID, nil, conf)
+	initialized, err := vm.state.IsInitialized()
+	if err != nil {
+		return nil, err
+	}
+	// a failed import leaves blocks behind without marking the database
+	// initialized, so check for blocks as well
+	_, err = vm.state.GetBlockIDAtHeight(0)
+	if initialized || err == nil {
+		return nil, fmt.Errorf("chain %s already has a database. Imports only go into an empty database", chainID)
+	}
+	if err != database.ErrNotFound {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLineSize)
+	var prev *Block
+	for line := 1; scanner.Scan(); line++ {
+		row := ExportedBlock{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		blk, err := importedBlock(row, prev, vm)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := vm.state.PutBlock(blk); err != nil {
+			return nil, err
+		}
+		prev = blk
+		if line%importCommitInterval == 0 {
+			log.Info("Import progress", "height", blk.Height())
+			if err := vm.state.Commit(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, errors.New("export is empty")
+	}
+
+	if err := vm.state.SetLastAccepted(prev.ID()); err != nil {
+		return nil, err
+	}
+	// schema version 0 makes every backfill migration run on first start
+	if err := vm.state.SetSchemaVersion(0); err != nil {
+		return nil, err
+	}
+	if err := vm.state.SetInitialized(); err != nil {
+		return nil, err
+	}
+	return prev, vm.state.Commit()
+}
+
+// importedBlock parses and checks [row], which follows [prev]
+func importedBlock(row ExportedBlock, prev *Block, vm *VM) (*Block, error) {
+	if row.Bytes == "" {
+		return nil, fmt.Errorf("block %s has no bytes. Export with zcash blocks included to import", row.ID)
+	}
+	if row.Status != choices.Accepted.String() {
+		return nil, fmt.Errorf("block %s has status %s. Only accepted blocks can be imported", row.ID, row.Status)
+	}
+	blkBytes, err := hex.DecodeString(row.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("block %s has invalid bytes: %w", row.ID, err)
+	}
+	blk, err := parseBlock(blkBytes, choices.Accepted, vm)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing block %s: %w", row.ID, err)
+	}
+	if blk.ID() != row.ID {
+		return nil, fmt.Errorf("block bytes hash to %s rather than %s", blk.ID(), row.ID)
+	}
+	if blk.Height() != row.Height || blk.Parent() != row.ParentID || blk.CreationTime != row.Timestamp || blk.ProducingNode != row.ProducingNode {
+		return nil, fmt.Errorf("block %s doesn't match the fields exported with it", row.ID)
+	}
+	if prev == nil {
+		if blk.Height() != 0 {
+			return nil, fmt.Errorf("export starts at height %d rather than genesis", blk.Height())
+		}
+		return blk, nil
+	}
+	if blk.Height() != prev.Height()+1 {
+		return nil, fmt.Errorf("block %s at height %d follows height %d", blk.ID(), blk.Height(), prev.Height())
+	}
+	if blk.Parent() != prev.ID() {
+		return nil, fmt.Errorf("block %s has parent %s rather than %s", blk.ID(), blk.Parent(), prev.ID())
+	}
+	return blk, nil
+}
@@ -0,0 +1,125 @@
+package zapavm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+// zcash networks a genesis can name, as getblockchaininfo reports them
+var zcashNetworks = map[string]bool{
+	"main":    true,
+	"test":    true,
+	"regtest": true,
+}
+
+var errGenesisMismatch = errors.New("zcashd's genesis doesn't match the chain's genesis")
+
+// Genesis is the JSON carried in the chain's genesisData. Block 0 is built
+// from it, so every validator starts from the same block whatever its
+// zcashd holds.
+type Genesis struct {
+	// Network is the zcash network zcashd must run: main, test or regtest
+	Network string `json:"network"`
+	// ZcashBlock is zcash's genesis block, serialized and hex encoded
+	ZcashBlock string `json:"zcashBlock"`
+	// Timestamp is block 0's creation time, in unix seconds
+	Timestamp int64 `json:"timestamp"`
+
+	zblk  []byte
+	zhash string
+}
+
+// ParseGenesis parses [genesisData]. Data that isn't a JSON object, such as
+// the builds/emptygenesis.txt placeholder chains were created with before
+// the genesis format existed, returns a nil Genesis: those chains ingest
+// their genesis from zcashd.
+func ParseGenesis(genesisData []byte) (*Genesis, error) {
+	trimmed := bytes.TrimSpace(genesisData)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.DisallowUnknownFields()
+	g := &Genesis{}
+	if err := dec.Decode(g); err != nil {
+		return nil, fmt.Errorf("error parsing genesis: %w", err)
+	}
+	if !zcashNetworks[g.Network] {
+		return nil, fmt.Errorf("genesis names unknown zcash network %q", g.Network)
+	}
+	zblk, err := hex.DecodeString(g.ZcashBlock)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding genesis zcash block: %w", err)
+	}
+	if g.zhash, err = zclient.ZBlockHash(zblk); err != nil {
+		return nil, fmt.Errorf("invalid genesis zcash block: %w", err)
+	}
+	g.zblk = zblk
+	return g, nil
+}
+
+// GenesisFromZcash builds a Genesis from zcashd's genesis block
+func GenesisFromZcash(zc zclient.ZcashClient) (*Genesis, error) {
+	network, err := zc.GetNetwork()
+	if err != nil {
+		return nil, fmt.Errorf("error getting zcashd's network: %w", err)
+	}
+	res := zc.GetZBlock(0)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error getting zcashd's genesis block: %w", res.Error)
+	}
+	return ParseGenesis([]byte(fmt.Sprintf(
+		`{"network":%q,"zcashBlock":%q,"timestamp":%d}`,
+		network, hex.EncodeToString(res.Block), res.Timestamp,
+	)))
+}
+
+// ZcashHash returns the hash of the genesis zcash block
+func (g *Genesis) ZcashHash() string { return g.zhash }
+
+// Block builds block 0 of [vm]'s chain
+func (g *Genesis) Block(vm *VM) (*Block, error) {
+	return vm.NewBlock(ids.Empty, 0, g.zblk, g.Timestamp)
+}
+
+// checkZcashGenesis checks that zcashd runs [g]'s network and has its
+// genesis block
+func (vm *VM) checkZcashGenesis(g *Genesis) error {
+	network, err := vm.zc.GetNetwork()
+	if err != nil {
+		return fmt.Errorf("error getting zcashd's network: %w", err)
+	}
+	if network != g.Network {
+		return fmt.Errorf("%w: zcashd runs %s rather than %s", errGenesisMismatch, network, g.Network)
+	}
+	zhash, err := vm.zc.GetBlockHash(0)
+	if err != nil {
+		return fmt.Errorf("error getting zcashd's genesis hash: %w", err)
+	}
+	if zhash != g.zhash {
+		return fmt.Errorf("%w: zcashd's genesis block is %s rather than %s", errGenesisMismatch, zhash, g.zhash)
+	}
+	return nil
+}
+
+// checkGenesisBlock checks that the accepted block 0 is the one [g] builds
+func (vm *VM) checkGenesisBlock(g *Genesis) error {
+	expected, err := g.Block(vm)
+	if err != nil {
+		return fmt.Errorf("error building genesis block: %w", err)
+	}
+	blkID, err := vm.state.GetBlockIDAtHeight(0)
+	if err != nil {
+		return fmt.Errorf("error getting genesis block: %w", err)
+	}
+	if blkID != expected.ID() {
+		return fmt.Errorf("database's genesis block %s isn't %s, the block genesisData builds", blkID, expected.ID())
+	}
+	return nil
+}
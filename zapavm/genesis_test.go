@@ -0,0 +1,148 @@
+package zapavm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/hashing"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+// testGenesisZBlock returns a raw zcash block with a three byte solution
+// followed by [body]
+func testGenesisZBlock(body ...byte) []byte {
+	zblk := make([]byte, 4+32+32+32+4+4+32)
+	zblk[0] = 4
+	zblk = append(zblk, 3, 0xaa, 0xbb, 0xcc)
+	return append(zblk, body...)
+}
+
+func testGenesisData(network string, zblk []byte, timestamp int64) []byte {
+	return []byte(fmt.Sprintf(`{"network":%q,"zcashBlock":%q,"timestamp":%d}`, network, hex.EncodeToString(zblk), timestamp))
+}
+
+func TestParseGenesis(t *testing.T) {
+	zblk := testGenesisZBlock(0x01)
+	tests := []struct {
+		name        string
+		genesisData []byte
+		wantNil     bool
+		wantErr     bool
+	}{
+		{"empty", nil, true, false},
+		{"empty genesis placeholder", []byte("  \n"), true, false},
+		{"not an object", []byte("emptygenesis"), true, false},
+		{"main", testGenesisData("main", zblk, 1), false, false},
+		{"test", testGenesisData("test", zblk, 1), false, false},
+		{"regtest", testGenesisData("regtest", zblk, 1), false, false},
+		{"unknown network", testGenesisData("mainnet", zblk, 1), false, true},
+		{"unknown field", []byte(`{"network":"main","zcashBlock":"00","timestamp":1,"height":0}`), false, true},
+		{"zcash block not hex", []byte(`{"network":"main","zcashBlock":"zz","timestamp":1}`), false, true},
+		{"zcash block too short", testGenesisData("main", zblk[:100], 1), false, true},
+		{"malformed json", []byte(`{"network":`), false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := ParseGenesis(test.genesisData)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseGenesis() error = %v, expected error: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if (g == nil) != test.wantNil {
+				t.Fatalf("ParseGenesis() = %v, expected nil: %v", g, test.wantNil)
+			}
+			if g == nil {
+				return
+			}
+			zhash, err := zclient.ZBlockHash(zblk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.ZcashHash() != zhash {
+				t.Fatalf("ZcashHash() = %s, expected %s", g.ZcashHash(), zhash)
+			}
+		})
+	}
+}
+
+func TestGenesisBlockID(t *testing.T) {
+	zblk := testGenesisZBlock(0x01)
+	legacy := &Block{ZBlk: zclient.EncodeZBlock(zblk), CreationTime: 1000}
+	legacyBytes, err := Codec.Marshal(legacyCodecVersion, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := &Block{ZBlk: zblk, CreationTime: 1000}
+	rawBytes, err := Codec.Marshal(CodecVersion, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		genesisData []byte
+		upgradeData string
+		wantID      ids.ID
+	}{
+		{"legacy", testGenesisData("main", zblk, 1000), "", hashing.ComputeHash256Array(legacyBytes)},
+		{"raw from genesis", testGenesisData("main", zblk, 1000), `{"rawZcashBlocks":{"height":0}}`, hashing.ComputeHash256Array(rawBytes)},
+		{"raw later", testGenesisData("main", zblk, 1000), `{"rawZcashBlocks":{"height":1}}`, hashing.ComputeHash256Array(legacyBytes)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := ParseGenesis(test.genesisData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			upgrades, err := ParseUpgradeSchedule([]byte(test.upgradeData))
+			if err != nil {
+				t.Fatal(err)
+			}
+			blk, err := g.Block(&VM{upgrades: upgrades})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blk.ID() != test.wantID {
+				t.Fatalf("genesis block ID = %s, expected %s", blk.ID(), test.wantID)
+			}
+			if blk.Height() != 0 || blk.Parent() != ids.Empty || blk.ProducingNode != "" {
+				t.Fatal("genesis block has a parent, height or producer")
+			}
+			if !bytes.Equal(blk.ZBlock(), zblk) {
+				t.Fatal("genesis block doesn't carry the raw zcash block")
+			}
+		})
+	}
+}
+
+func TestGenesisBlockIDDependsOnGenesis(t *testing.T) {
+	vm := &VM{}
+	build := func(genesisData []byte) ids.ID {
+		g, err := ParseGenesis(genesisData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blk, err := g.Block(vm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blk.ID()
+	}
+
+	zblk := testGenesisZBlock(0x01)
+	base := build(testGenesisData("main", zblk, 1000))
+	if build(testGenesisData("main", zblk, 1000)) != base {
+		t.Fatal("the same genesis built different blocks")
+	}
+	if build(testGenesisData("main", zblk, 1001)) == base {
+		t.Fatal("genesis timestamp doesn't change block 0")
+	}
+	if build(testGenesisData("main", testGenesisZBlock(0x02), 1000)) == base {
+		t.Fatal("genesis zcash block doesn't change block 0")
+	}
+}
@@ -0,0 +1,168 @@
+package zapavm
+
+import (
+	"fmt"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// indexAcceptedBlock adds accepted block [blk] to every secondary index. The
+// zcash index needs zcashd, so if it can't index [blk] now, [blk] is indexed
+// on the next startup instead.
+func (vm *VM) indexAcceptedBlock(blk *Block) error {
+	if err := vm.state.IndexProducedBlock(blk); err != nil {
+		return err
+	}
+	if err := vm.state.PutBlockTime(blk); err != nil {
+		return err
+	}
+	return vm.indexZcashBlockLater(blk)
+}
+
+// unindexAcceptedBlock removes [blk], which is no longer accepted, from
+// every secondary index
+func (vm *VM) unindexAcceptedBlock(blk *Block) error {
+	if err := vm.state.UnindexProducedBlock(blk); err != nil {
+		return err
+	}
+	if err := vm.state.DeleteBlockTime(blk); err != nil {
+		return err
+	}
+	if err := vm.state.DeleteUnindexedHeight(blk.Height()); err != nil {
+		return err
+	}
+	return vm.unindexZcashBlock(blk)
+}
+
+// indexZcashBlockLater adds [blk] to the zcash index, or records its height
+// for reindexZcashBlocks if zcashd can't serve it now
+func (vm *VM) indexZcashBlockLater(blk *Block) error {
+	if err := vm.indexZcashBlock(blk); err != nil {
+		log.Warn("Error indexing zcash block, indexing it on the next startup", append(blk.LogInfo(), "error", err)...)
+		return vm.state.PutUnindexedHeight(blk.Height())
+	}
+	return nil
+}
+
+// reindexZcashBlocks adds the accepted blocks indexZcashBlockLater deferred
+// to the zcash index. Blocks that still fail stay deferred.
+func (vm *VM) reindexZcashBlocks() error {
+	heights, err := vm.state.GetUnindexedHeights()
+	if err != nil {
+		return err
+	}
+	if len(heights) == 0 {
+		return nil
+	}
+	indexed := 0
+	for _, height := range heights {
+		blk, err := vm.GetBlockAtHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := vm.indexZcashBlock(blk); err != nil {
+			log.Warn("Error indexing zcash block, retrying on the next startup", append(blk.LogInfo(), "error", err)...)
+			continue
+		}
+		if err := vm.state.DeleteUnindexedHeight(height); err != nil {
+			return err
+		}
+		indexed++
+	}
+	log.Info("Indexed deferred zcash blocks", "indexed", indexed, "remaining", len(heights)-indexed)
+	return vm.state.Commit()
+}
+
+// indexZcashBlock adds [blk]'s zcash block and transactions to the zcash index
+func (vm *VM) indexZcashBlock(blk *Block) error {
+	zhash, err := blk.ZcashHash()
+	if err != nil {
+		return err
+	}
+	if err := vm.state.PutZcashBlock(zhash, blk.ID()); err != nil {
+		return err
+	}
+	txIDs, err := vm.zc.GetBlockTxIDs(zhash)
+	if err != nil {
+		return fmt.Errorf("error getting transactions of zcash block %s: %w", zhash, err)
+	}
+	loc := TxLocation{Height: blk.Height(), BlockID: blk.ID()}
+	for _, txID := range txIDs {
+		if err := vm.state.PutTxLocation(txID, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexZcashBlock removes [blk]'s zcash block and transactions from the
+// zcash index
+func (vm *VM) unindexZcashBlock(blk *Block) error {
+	zhash, err := blk.ZcashHash()
+	if err != nil {
+		return err
+	}
+	txIDs, err := vm.zc.GetBlockTxIDs(zhash)
+	if err != nil {
+		return fmt.Errorf("error getting transactions of zcash block %s: %w", zhash, err)
+	}
+	for _, txID := range txIDs {
+		if err := vm.state.DeleteTxLocation(txID); err != nil {
+			return err
+		}
+	}
+	return vm.state.DeleteZcashBlock(zhash)
+}
+
+// migrateZcashIndex adds blocks accepted before the zcash block and
+// transaction indexes existed to them
+func migrateZcashIndex(vm *VM, dryRun bool) error {
+	zcBlkCount, err := vm.zc.GetBlockCount()
+	if err != nil {
+		return fmt.Errorf("error getting zcash block count: %w", err)
+	}
+	// blocks zcashd doesn't have yet are indexed as initAndSync submits them
+	return migrateAcceptedBlocks(vm, "index zcash blocks and transactions", dryRun, func(blk *Block) error {
+		if blk.Height() > uint64(zcBlkCount) {
+			return nil
+		}
+		return vm.indexZcashBlock(blk)
+	})
+}
+
+// migrateProducerIndex counts blocks accepted before the producer index
+// existed towards their producers
+func migrateProducerIndex(vm *VM, dryRun bool) error {
+	return migrateAcceptedBlocks(vm, "index block producers", dryRun, vm.state.IndexProducedBlock)
+}
+
+// migrateTimeIndex adds blocks accepted before the time index existed to it
+func migrateTimeIndex(vm *VM, dryRun bool) error {
+	return migrateAcceptedBlocks(vm, "index block times", dryRun, vm.state.PutBlockTime)
+}
+
+// migrateAcceptedBlocks runs [index] over every accepted block in height order
+func migrateAcceptedBlocks(vm *VM, name string, dryRun bool, index func(*Block) error) error {
+	progress := &migrationProgress{vm: vm, name: name, dryRun: dryRun}
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return err
+	}
+	for height := uint64(0); height <= lastAccepted.Height(); height++ {
+		if err := progress.step(); err != nil {
+			return err
+		}
+		if dryRun {
+			continue
+		}
+		blk, err := vm.GetBlockAtHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := index(blk); err != nil {
+			return fmt.Errorf("error indexing block at height %d: %w", height, err)
+		}
+	}
+	log.Info("Indexed accepted blocks", "name", name, "blocks", lastAccepted.Height()+1, "dry run", dryRun)
+	return nil
+}
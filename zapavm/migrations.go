@@ -0,0 +1,150 @@
+package zapavm
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/snow/choices"
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	// number of items a migration processes between progress logs and commits
+	migrationCommitInterval = 10000
+)
+
+// migration upgrades the database layout to [version] from the version
+// before it. Migrations must be safe to rerun: one interrupted before the
+// schema version is bumped runs again on the next start.
+type migration struct {
+	version uint64
+	name    string
+	// run applies the migration. With [dryRun] set it only logs what it
+	// would change and must not write to the database.
+	run func(vm *VM, dryRun bool) error
+}
+
+// migrations is the ordered registry of every database migration. A
+// database with no recorded schema version is at version 0, the layout
+// from before versioning. Append new migrations with the next version.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "index rejected blocks",
+		run:     migrateRejectedIndex,
+	},
+	{
+		version: 2,
+		name:    "index zcash blocks and transactions",
+		run:     migrateZcashIndex,
+	},
+	{
+		version: 3,
+		name:    "index block producers",
+		run:     migrateProducerIndex,
+	},
+	{
+		version: 4,
+		name:    "index block times",
+		run:     migrateTimeIndex,
+	},
+}
+
+// latestSchemaVersion is the schema version this binary writes
+func latestSchemaVersion() uint64 {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate brings the database up to [latestSchemaVersion], refusing to
+// run against a database written by a newer binary
+func (vm *VM) migrate(dryRun bool) error {
+	initialized, err := vm.state.IsInitialized()
+	if err != nil {
+		return err
+	}
+	if !initialized {
+		// a fresh database is created with the latest layout
+		log.Info("Initializing database schema", "version", latestSchemaVersion())
+		return vm.state.SetSchemaVersion(latestSchemaVersion())
+	}
+
+	current, err := vm.state.GetSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("error reading database schema version: %w", err)
+	}
+	if current > latestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the latest version %d this binary understands", current, latestSchemaVersion())
+	}
+	if current == latestSchemaVersion() {
+		log.Debug("Database schema is up to date", "version", current)
+		return nil
+	}
+
+	log.Info("Migrating database schema", "from version", current, "to version", latestSchemaVersion(), "dry run", dryRun)
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		log.Info("Running migration", "version", m.version, "name", m.name, "dry run", dryRun)
+		if err := m.run(vm, dryRun); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		if dryRun {
+			continue
+		}
+		if err := vm.state.SetSchemaVersion(m.version); err != nil {
+			return err
+		}
+		if err := vm.state.Commit(); err != nil {
+			return err
+		}
+		log.Info("Finished migration", "version", m.version, "name", m.name)
+	}
+	if dryRun {
+		return fmt.Errorf("dry run of migrations from schema version %d to %d complete, refusing to start on an unmigrated database", current, latestSchemaVersion())
+	}
+	return nil
+}
+
+// migrationProgress logs progress and commits every [migrationCommitInterval]
+// items, so long migrations neither go quiet nor hold every write in memory
+type migrationProgress struct {
+	vm     *VM
+	name   string
+	dryRun bool
+	seen   int
+}
+
+func (p *migrationProgress) step() error {
+	p.seen++
+	if p.seen%migrationCommitInterval != 0 {
+		return nil
+	}
+	log.Info("Migration progress", "name", p.name, "processed", p.seen)
+	if p.dryRun {
+		return nil
+	}
+	return p.vm.state.Commit()
+}
+
+// migrateRejectedIndex adds blocks rejected before the rejected index
+// existed to it
+func migrateRejectedIndex(vm *VM, dryRun bool) error {
+	progress := &migrationProgress{vm: vm, name: "index rejected blocks", dryRun: dryRun}
+	indexed := 0
+	err := vm.state.ForEachBlock(func(blk *Block) error {
+		if err := progress.step(); err != nil {
+			return err
+		}
+		if blk.Status() != choices.Rejected {
+			return nil
+		}
+		indexed++
+		if dryRun {
+			log.Info("Would index rejected block", blk.LogInfo()...)
+			return nil
+		}
+		return vm.state.PutRejectedBlock(blk)
+	})
+	log.Info("Indexed rejected blocks", "blocks scanned", progress.seen, "rejected blocks", indexed, "dry run", dryRun)
+	return err
+}
@@ -0,0 +1,133 @@
+package zapavm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/database/manager"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow"
+	"github.com/ava-labs/avalanchego/utils/logging"
+	"github.com/ava-labs/avalanchego/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+// prefix avalanchego puts in front of a chain's VM database, within the
+// chain's own prefix
+var vmDBPrefix = []byte("vm")
+
+// OpenNodeDatabase opens the database of a stopped avalanchego node at
+// [dbDir], the node's db directory including the network name
+// (e.g. ~/.avalanchego/db/fuji). It returns the manager, to be closed by the
+// caller, and the database chain [chainID] sees as its VM database.
+func OpenNodeDatabase(dbDir string, chainID ids.ID) (manager.Manager, database.Database, error) {
+	dbManager, err := manager.NewLevelDB(dbDir, nil, logging.NoLog{}, version.CurrentDatabase, "db", prometheus.NewRegistry())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening node database at %s: %w", dbDir, err)
+	}
+	chainDBManager := dbManager.NewPrefixDBManager(chainID[:]).NewPrefixDBManager(vmDBPrefix)
+	return dbManager, chainDBManager.Current().Database, nil
+}
+
+// OpenNodeDatabaseReadOnly is OpenNodeDatabase for tools that only read.
+// LevelDB opens the current database version under [dbDir] read-only, so it
+// must already exist and every write to the returned database fails.
+func OpenNodeDatabaseReadOnly(dbDir string, chainID ids.ID) (manager.Manager, database.Database, error) {
+	versionDir := filepath.Join(dbDir, version.CurrentDatabase.String())
+	if _, err := os.Stat(versionDir); err != nil {
+		return nil, nil, fmt.Errorf("error opening node database: %w", err)
+	}
+	ldb, err := leveldb.OpenFile(versionDir, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening node database at %s: %w", versionDir, err)
+	}
+	dbManager, err := manager.NewManagerFromDBs([]*manager.VersionedDatabase{{
+		Database: &readOnlyLevelDB{db: ldb},
+		Version:  version.CurrentDatabase,
+	}})
+	if err != nil {
+		_ = ldb.Close()
+		return nil, nil, err
+	}
+	chainDBManager := dbManager.NewPrefixDBManager(chainID[:]).NewPrefixDBManager(vmDBPrefix)
+	return dbManager, chainDBManager.Current().Database, nil
+}
+
+// NewOfflineVM returns a VM over chain [chainID]'s database [db] for tools
+// that run while the node is stopped. It is not initialized with the
+// consensus engine, and [zc] is only used by operations that reach zcashd.
+func NewOfflineVM(db database.Database, chainID ids.ID, zc zclient.ZcashClient, conf ChainConfig) (*VM, error) {
+	vm := newOfflineVM(db, chainID, zc, conf)
+	initialized, err := vm.state.IsInitialized()
+	if err != nil {
+		return nil, err
+	}
+	if !initialized {
+		return nil, fmt.Errorf("chain %s has no initialized database", chainID)
+	}
+	schemaVersion, err := vm.state.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if schemaVersion > latestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than the latest version %d this binary understands", schemaVersion, latestSchemaVersion())
+	}
+	if err := vm.initializePreference(); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// newOfflineVM returns a VM over [db] without checking the database
+func newOfflineVM(db database.Database, chainID ids.ID, zc zclient.ZcashClient, conf ChainConfig) *VM {
+	vm := &VM{
+		ctx:            &snow.Context{ChainID: chainID},
+		zc:             zc,
+		config:         conf,
+		verifiedBlocks: make(map[ids.ID]*Block),
+		shutdownChan:   make(chan struct{}),
+	}
+	vm.state = NewState(db, vm)
+	return vm
+}
+
+// DatabaseInfo summarizes a chain's database
+type DatabaseInfo struct {
+	ChainID             ids.ID       `json:"chainID"`
+	SchemaVersion       uint64       `json:"schemaVersion"`
+	LatestSchemaVersion uint64       `json:"latestSchemaVersion"` // the version this binary writes
+	LastAcceptedID      ids.ID       `json:"lastAcceptedID"`
+	LastAcceptedHeight  uint64       `json:"lastAcceptedHeight"`
+	PrunedHeight        uint64       `json:"prunedHeight"`
+	Storage             StorageStats `json:"storage"`
+}
+
+// InspectDatabase summarizes the VM's database
+func (vm *VM) InspectDatabase() (DatabaseInfo, error) {
+	info := DatabaseInfo{
+		ChainID:             vm.ctx.ChainID,
+		LatestSchemaVersion: latestSchemaVersion(),
+	}
+	var err error
+	if info.SchemaVersion, err = vm.state.GetSchemaVersion(); err != nil {
+		return info, err
+	}
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return info, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	info.LastAcceptedID = lastAccepted.ID()
+	info.LastAcceptedHeight = lastAccepted.Height()
+	if info.PrunedHeight, err = vm.state.GetPrunedHeight(); err != nil {
+		return info, err
+	}
+	if info.Storage, err = vm.state.StorageStats(); err != nil {
+		return info, fmt.Errorf("error computing storage stats: %w", err)
+	}
+	return info, nil
+}
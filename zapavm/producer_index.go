@@ -0,0 +1,479 @@
+package zapavm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+const (
+	producerCountByte  byte = iota // producer --> number of blocks produced
+	producerHeightByte             // producer, height --> number of blocks produced up to and including height
+	producerSeqByte                // producer, n --> n-th block produced
+	producerHourByte               // hour, producer --> bucket
+	producerDayByte                // day, producer --> bucket
+)
+
+const (
+	ProducerIntervalHour = "hour"
+	ProducerIntervalDay  = "day"
+
+	secondsPerHour = 60 * 60
+	secondsPerDay  = 24 * secondsPerHour
+)
+
+// time buckets producer statistics are kept in, by interval name
+var producerIntervals = map[string]struct {
+	kind    byte
+	seconds int64
+}{
+	ProducerIntervalHour: {producerHourByte, secondsPerHour},
+	ProducerIntervalDay:  {producerDayByte, secondsPerDay},
+}
+
+var _ ProducerIndex = &producerIndex{}
+
+// ProducerIndex keeps running block counts per producing node, so
+// statistics over a height range take a few seeks rather than a walk of the
+// chain. Counts are also bucketed by the hour and day blocks were created.
+type ProducerIndex interface {
+	// IndexProducedBlock counts accepted block [blk] towards its producer.
+	// Blocks must be indexed in height order. Indexing a block twice is a no-op.
+	IndexProducedBlock(blk *Block) error
+	// UnindexProducedBlock reverses IndexProducedBlock. [blk] must be the
+	// highest indexed block of its producer.
+	UnindexProducedBlock(blk *Block) error
+
+	// GetProducers returns every node that produced an indexed block
+	GetProducers() ([]string, error)
+	// GetProducerStats summarizes the blocks [producer] produced with
+	// [from] <= height < [to]
+	GetProducerStats(producer string, from uint64, to uint64) (ProducerStats, error)
+	// GetProducerStatsInTimeRange summarizes the blocks each node produced
+	// with a creation time in [from, to), widened to whole hours
+	GetProducerStatsInTimeRange(from int64, to int64) (map[string]ProducerStats, error)
+	// GetProducerBuckets returns the non-empty [interval] buckets overlapping
+	// [from, to), in time order
+	GetProducerBuckets(interval string, from int64, to int64) ([]ProducerBucket, error)
+}
+
+// ProducedBlock identifies a block in producer statistics
+type ProducedBlock struct {
+	Height       uint64 `serialize:"true" json:"height"`
+	ID           ids.ID `serialize:"true" json:"id"`
+	CreationTime int64  `serialize:"true" json:"creationTime"`
+}
+
+// ProducerStats summarizes the blocks a node produced in a range. First and
+// Last are the lowest and highest of them.
+type ProducerStats struct {
+	Count uint64         `json:"count"`
+	First *ProducedBlock `json:"first,omitempty"`
+	Last  *ProducedBlock `json:"last,omitempty"`
+}
+
+// ProducerBucket is the blocks each node produced in the time bucket
+// starting at Start, in unix seconds
+type ProducerBucket struct {
+	Start     int64                    `json:"start"`
+	Producers map[string]ProducerStats `json:"producers"`
+}
+
+// producerBucketEntry is the value stored for a producer's time bucket
+type producerBucketEntry struct {
+	Count uint64        `serialize:"true"`
+	First ProducedBlock `serialize:"true"`
+	Last  ProducedBlock `serialize:"true"`
+}
+
+type producerIndex struct {
+	db database.Database
+}
+
+// NewProducerIndex returns a ProducerIndex stored in [db]
+func NewProducerIndex(db database.Database) ProducerIndex {
+	return &producerIndex{db: db}
+}
+
+// producerKey is [kind] followed by the length prefixed [producer], so no
+// producer's keys are a prefix of another's
+func producerKey(kind byte, producer string) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, 1+wrappers.ShortLen+len(producer))}
+	p.PackByte(kind)
+	p.PackStr(producer)
+	return p.Bytes
+}
+
+// producerNumKey orders a producer's entries of [kind] by [n]
+func producerNumKey(kind byte, producer string, n uint64) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, 1+wrappers.ShortLen+len(producer)+wrappers.LongLen)}
+	p.PackByte(kind)
+	p.PackStr(producer)
+	p.PackLong(n)
+	return p.Bytes
+}
+
+// producerBucketKey orders buckets of [kind] by start time, then producer
+func producerBucketKey(kind byte, start int64, producer string) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, 1+wrappers.LongLen+wrappers.ShortLen+len(producer))}
+	p.PackByte(kind)
+	p.PackLong(uint64(start))
+	p.PackStr(producer)
+	return p.Bytes
+}
+
+func producedBlock(blk *Block) ProducedBlock {
+	return ProducedBlock{
+		Height:       blk.Height(),
+		ID:           blk.ID(),
+		CreationTime: blk.CreationTime,
+	}
+}
+
+func (p *producerIndex) IndexProducedBlock(blk *Block) error {
+	producer := blk.ProducingNode
+	if producer == "" {
+		return nil
+	}
+	heightKey := producerNumKey(producerHeightByte, producer, blk.Height())
+	if indexed, err := p.db.Has(heightKey); err != nil || indexed {
+		return err
+	}
+
+	count, err := p.getCount(producer)
+	if err != nil {
+		return err
+	}
+	count++
+	if err := p.putProduced(producer, count, producedBlock(blk)); err != nil {
+		return err
+	}
+	if err := database.PutUInt64(p.db, heightKey, count); err != nil {
+		return err
+	}
+	if err := database.PutUInt64(p.db, producerKey(producerCountByte, producer), count); err != nil {
+		return err
+	}
+
+	for _, interval := range producerIntervals {
+		start := bucketStart(blk.CreationTime, interval.seconds)
+		entry, err := p.getBucket(interval.kind, start, producer)
+		if err != nil {
+			return err
+		}
+		entry.Count++
+		pb := producedBlock(blk)
+		if entry.Count == 1 || pb.Height < entry.First.Height {
+			entry.First = pb
+		}
+		if entry.Count == 1 || pb.Height > entry.Last.Height {
+			entry.Last = pb
+		}
+		if err := p.putBucket(interval.kind, start, producer, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *producerIndex) UnindexProducedBlock(blk *Block) error {
+	producer := blk.ProducingNode
+	if producer == "" {
+		return nil
+	}
+	heightKey := producerNumKey(producerHeightByte, producer, blk.Height())
+	n, err := database.GetUInt64(p.db, heightKey)
+	if err == database.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	count, err := p.getCount(producer)
+	if err != nil {
+		return err
+	}
+	if n != count {
+		return fmt.Errorf("block %s at height %d is not the highest block produced by %s", blk.ID(), blk.Height(), producer)
+	}
+
+	if err := p.db.Delete(heightKey); err != nil {
+		return err
+	}
+	if err := p.db.Delete(producerNumKey(producerSeqByte, producer, count)); err != nil {
+		return err
+	}
+	count--
+	if count == 0 {
+		err = p.db.Delete(producerKey(producerCountByte, producer))
+	} else {
+		err = database.PutUInt64(p.db, producerKey(producerCountByte, producer), count)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, interval := range producerIntervals {
+		start := bucketStart(blk.CreationTime, interval.seconds)
+		entry, err := p.getBucket(interval.kind, start, producer)
+		if err != nil {
+			return err
+		}
+		if entry.Count <= 1 {
+			if err := p.db.Delete(producerBucketKey(interval.kind, start, producer)); err != nil {
+				return err
+			}
+			continue
+		}
+		entry.Count--
+		// [blk] is the producer's highest block, so it can only have been
+		// the bucket's last. Its predecessor in the bucket is the next
+		// highest block of the producer created within the bucket.
+		if entry.Last.ID == blk.ID() {
+			for n := count; n > 0; n-- {
+				pb, err := p.getProduced(producer, n)
+				if err != nil {
+					return err
+				}
+				if bucketStart(pb.CreationTime, interval.seconds) == start {
+					entry.Last = pb
+					break
+				}
+			}
+		}
+		if err := p.putBucket(interval.kind, start, producer, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *producerIndex) GetProducers() ([]string, error) {
+	it := p.db.NewIteratorWithPrefix([]byte{producerCountByte})
+	defer it.Release()
+
+	producers := []string{}
+	for it.Next() {
+		pk := wrappers.Packer{Bytes: it.Key(), Offset: 1}
+		producer := pk.UnpackStr()
+		if pk.Errored() {
+			return nil, fmt.Errorf("corrupt producer key %x: %w", it.Key(), pk.Err)
+		}
+		producers = append(producers, producer)
+	}
+	return producers, it.Error()
+}
+
+func (p *producerIndex) GetProducerStats(producer string, from uint64, to uint64) (ProducerStats, error) {
+	stats := ProducerStats{}
+	if from >= to {
+		return stats, nil
+	}
+	before, err := p.countBelow(producer, from)
+	if err != nil {
+		return stats, err
+	}
+	through, err := p.countBelow(producer, to)
+	if err != nil {
+		return stats, err
+	}
+	stats.Count = through - before
+	if stats.Count == 0 {
+		return stats, nil
+	}
+	first, err := p.getProduced(producer, before+1)
+	if err != nil {
+		return stats, err
+	}
+	last, err := p.getProduced(producer, through)
+	if err != nil {
+		return stats, err
+	}
+	stats.First = &first
+	stats.Last = &last
+	return stats, nil
+}
+
+// countBelow returns how many blocks [producer] produced below [height].
+// The count at the producer's first block at or above [height] includes
+// that block, so one seek answers it.
+func (p *producerIndex) countBelow(producer string, height uint64) (uint64, error) {
+	it := p.db.NewIteratorWithStartAndPrefix(
+		producerNumKey(producerHeightByte, producer, height),
+		producerKey(producerHeightByte, producer),
+	)
+	defer it.Release()
+
+	if it.Next() {
+		count, err := database.ParseUInt64(it.Value())
+		if err != nil {
+			return 0, err
+		}
+		return count - 1, nil
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	return p.getCount(producer)
+}
+
+func (p *producerIndex) GetProducerStatsInTimeRange(from int64, to int64) (map[string]ProducerStats, error) {
+	from = bucketStart(from, secondsPerHour)
+	if to < math.MaxInt64-secondsPerHour {
+		to = bucketStart(to+secondsPerHour-1, secondsPerHour)
+	}
+	stats := make(map[string]ProducerStats)
+	if from >= to {
+		return stats, nil
+	}
+
+	// whole days are summed from day buckets and the hours either side of
+	// them from hour buckets
+	type bucketRange struct {
+		interval string
+		from, to int64
+	}
+	ranges := []bucketRange{{ProducerIntervalHour, from, to}}
+	dayFrom := bucketStart(from+secondsPerDay-1, secondsPerDay)
+	dayTo := bucketStart(to, secondsPerDay)
+	if dayFrom < dayTo {
+		ranges = []bucketRange{
+			{ProducerIntervalHour, from, dayFrom},
+			{ProducerIntervalDay, dayFrom, dayTo},
+			{ProducerIntervalHour, dayTo, to},
+		}
+	}
+	for _, r := range ranges {
+		buckets, err := p.GetProducerBuckets(r.interval, r.from, r.to)
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			for producer, bucketStats := range bucket.Producers {
+				stats[producer] = mergeProducerStats(stats[producer], bucketStats)
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (p *producerIndex) GetProducerBuckets(interval string, from int64, to int64) ([]ProducerBucket, error) {
+	i, ok := producerIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %q, expected %q or %q", interval, ProducerIntervalHour, ProducerIntervalDay)
+	}
+	if from < 0 {
+		from = 0
+	}
+	it := p.db.NewIteratorWithStartAndPrefix(
+		producerBucketKey(i.kind, bucketStart(from, i.seconds), ""),
+		[]byte{i.kind},
+	)
+	defer it.Release()
+
+	buckets := []ProducerBucket{}
+	for it.Next() {
+		pk := wrappers.Packer{Bytes: it.Key(), Offset: 1}
+		start := int64(pk.UnpackLong())
+		producer := pk.UnpackStr()
+		if pk.Errored() {
+			return nil, fmt.Errorf("corrupt producer bucket key %x: %w", it.Key(), pk.Err)
+		}
+		if start >= to {
+			break
+		}
+		entry := producerBucketEntry{}
+		if _, err := Codec.Unmarshal(it.Value(), &entry); err != nil {
+			return nil, err
+		}
+		if len(buckets) == 0 || buckets[len(buckets)-1].Start != start {
+			buckets = append(buckets, ProducerBucket{
+				Start:     start,
+				Producers: make(map[string]ProducerStats),
+			})
+		}
+		first, last := entry.First, entry.Last
+		buckets[len(buckets)-1].Producers[producer] = ProducerStats{
+			Count: entry.Count,
+			First: &first,
+			Last:  &last,
+		}
+	}
+	return buckets, it.Error()
+}
+
+// mergeProducerStats combines the statistics of two disjoint ranges
+func mergeProducerStats(a ProducerStats, b ProducerStats) ProducerStats {
+	if a.Count == 0 {
+		return b
+	}
+	if b.Count == 0 {
+		return a
+	}
+	merged := ProducerStats{Count: a.Count + b.Count, First: a.First, Last: a.Last}
+	if b.First.Height < merged.First.Height {
+		merged.First = b.First
+	}
+	if b.Last.Height > merged.Last.Height {
+		merged.Last = b.Last
+	}
+	return merged
+}
+
+// bucketStart rounds [timestamp] down to a multiple of [seconds]
+func bucketStart(timestamp int64, seconds int64) int64 {
+	if timestamp < 0 {
+		return 0
+	}
+	return timestamp - timestamp%seconds
+}
+
+func (p *producerIndex) getCount(producer string) (uint64, error) {
+	count, err := database.GetUInt64(p.db, producerKey(producerCountByte, producer))
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (p *producerIndex) getProduced(producer string, n uint64) (ProducedBlock, error) {
+	pb := ProducedBlock{}
+	pbBytes, err := p.db.Get(producerNumKey(producerSeqByte, producer, n))
+	if err != nil {
+		return pb, fmt.Errorf("error getting block %d produced by %s: %w", n, producer, err)
+	}
+	_, err = Codec.Unmarshal(pbBytes, &pb)
+	return pb, err
+}
+
+func (p *producerIndex) putProduced(producer string, n uint64, pb ProducedBlock) error {
+	pbBytes, err := Codec.Marshal(CodecVersion, &pb)
+	if err != nil {
+		return err
+	}
+	return p.db.Put(producerNumKey(producerSeqByte, producer, n), pbBytes)
+}
+
+func (p *producerIndex) getBucket(kind byte, start int64, producer string) (producerBucketEntry, error) {
+	entry := producerBucketEntry{}
+	entryBytes, err := p.db.Get(producerBucketKey(kind, start, producer))
+	if err == database.ErrNotFound {
+		return entry, nil
+	}
+	if err != nil {
+		return entry, err
+	}
+	_, err = Codec.Unmarshal(entryBytes, &entry)
+	return entry, err
+}
+
+func (p *producerIndex) putBucket(kind byte, start int64, producer string, entry producerBucketEntry) error {
+	entryBytes, err := Codec.Marshal(CodecVersion, &entry)
+	if err != nil {
+		return err
+	}
+	return p.db.Put(producerBucketKey(kind, start, producer), entryBytes)
+}
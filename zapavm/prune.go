@@ -0,0 +1,177 @@
+package zapavm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+	"github.com/ava-labs/avalanchego/utils/hashing"
+	log "github.com/inconshreveable/log15"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+const (
+	// default number of accepted blocks below the last accepted block that
+	// keep their zcash block when pruning is enabled
+	defaultPruningRetention = 4096
+
+	// maximum number of blocks pruned per accepted block, so a node that
+	// turns pruning on catches up gradually rather than in one long pause
+	pruneBatchSize = 256
+)
+
+var (
+	errPrunedPayloadMismatch = errors.New("zcash block fetched from zcashd does not hash to the pruned block's ID")
+	errZcashMissingPruned    = errors.New("zcashd doesn't have every pruned block")
+)
+
+// prunedBlock is what the database keeps of an accepted block once its
+// zcash block has been pruned. The zcash block itself lives on in zcashd.
+type prunedBlock struct {
+	PrntID        ids.ID `serialize:"true"`
+	Hght          uint64 `serialize:"true"`
+	CreationTime  int64  `serialize:"true"`
+	ProducingNode string `serialize:"true"`
+	ZHash         string `serialize:"true"` // hash of the zcash block, as zcashd displays it
+	CodecVersion  uint16 `serialize:"true"` // codec version the full block was marshalled with
+}
+
+// marshalPrunedBlock returns the bytes stored in place of [blk] once pruned
+func marshalPrunedBlock(blk *Block) ([]byte, error) {
+	zhash, err := blk.ZcashHash()
+	if err != nil {
+		return nil, err
+	}
+	return Codec.Marshal(CodecVersion, &prunedBlock{
+		PrntID:        blk.PrntID,
+		Hght:          blk.Hght,
+		CreationTime:  blk.CreationTime,
+		ProducingNode: blk.ProducingNode,
+		ZHash:         zhash,
+		CodecVersion:  blk.codecVersion,
+	})
+}
+
+// parsePrunedBlock rebuilds the header of block [blkID] from [headerBytes].
+// The zcash block and block bytes are fetched from zcashd when first needed.
+func parsePrunedBlock(blkID ids.ID, headerBytes []byte, status choices.Status, vm *VM) (*Block, error) {
+	header := prunedBlock{}
+	if _, err := Codec.Unmarshal(headerBytes, &header); err != nil {
+		return nil, err
+	}
+	return &Block{
+		PrntID:        header.PrntID,
+		Hght:          header.Hght,
+		CreationTime:  header.CreationTime,
+		ProducingNode: header.ProducingNode,
+		id:            blkID,
+		status:        status,
+		vm:            vm,
+		codecVersion:  header.CodecVersion,
+		pruned:        true,
+		zhash:         header.ZHash,
+	}, nil
+}
+
+// loadPayload fetches the zcash block of a pruned block from zcashd and
+// rebuilds the block bytes, checking that they still hash to the block's ID
+func (b *Block) loadPayload() error {
+	if !b.pruned || b.bytes != nil {
+		return nil
+	}
+	res := b.vm.zc.GetZBlock(int(b.Hght))
+	if res.Error != nil {
+		return fmt.Errorf("error fetching pruned zcash block at height %d: %w", b.Hght, res.Error)
+	}
+	full := &Block{
+		PrntID:        b.PrntID,
+		Hght:          b.Hght,
+		ZBlk:          res.Block,
+		CreationTime:  b.CreationTime,
+		ProducingNode: b.ProducingNode,
+	}
+	if b.codecVersion == legacyCodecVersion {
+		full.ZBlk = zclient.EncodeZBlock(res.Block)
+	}
+	bytes, err := Codec.Marshal(b.codecVersion, full)
+	if err != nil {
+		return err
+	}
+	if hashing.ComputeHash256Array(bytes) != b.id {
+		return errPrunedPayloadMismatch
+	}
+	b.setPayload(res.Block, bytes)
+	return nil
+}
+
+// LoadBytes returns the block's bytes, rebuilding them from zcashd if the
+// block was pruned
+func (b *Block) LoadBytes() ([]byte, error) {
+	if err := b.loadPayload(); err != nil {
+		return nil, err
+	}
+	return b.bytes, nil
+}
+
+// LoadZBlock returns the block's zcash block, fetching it from zcashd if the
+// block was pruned
+func (b *Block) LoadZBlock() ([]byte, error) {
+	if err := b.loadPayload(); err != nil {
+		return nil, err
+	}
+	return b.ZBlk, nil
+}
+
+// setPayload restores the zcash block and bytes of a pruned block
+func (b *Block) setPayload(zblk []byte, bytes []byte) {
+	b.ZBlk = zblk
+	b.bytes = bytes
+}
+
+// pruneBlocks drops the zcash block of accepted blocks more than
+// [ChainConfig.PruningRetention] below the last accepted block
+func (vm *VM) pruneBlocks() error {
+	if !vm.config.Pruning {
+		return nil
+	}
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return err
+	}
+	if lastAccepted.Height() <= vm.config.PruningRetention {
+		return nil
+	}
+	pruneTo := lastAccepted.Height() - vm.config.PruningRetention
+
+	next, err := vm.state.GetPrunedHeight()
+	if err != nil {
+		return err
+	}
+	if next >= pruneTo {
+		return nil
+	}
+	if pruneTo-next > pruneBatchSize {
+		pruneTo = next + pruneBatchSize
+	}
+	// a pruned block can only be fetched back from zcashd, so blocks zcashd
+	// doesn't have yet stay whole
+	zcBlkCount, err := vm.zc.GetBlockCount()
+	if err != nil {
+		return fmt.Errorf("error getting zcash block count: %w", err)
+	}
+	if uint64(zcBlkCount) < pruneTo {
+		pruneTo = uint64(zcBlkCount) + 1
+	}
+	for ; next < pruneTo; next++ {
+		blk, err := vm.GetBlockAtHeight(next)
+		if err != nil {
+			return err
+		}
+		if err := vm.state.PruneBlock(blk); err != nil {
+			return fmt.Errorf("error pruning block at height %d: %w", next, err)
+		}
+	}
+	log.Debug("Pruned zcash blocks", "below height", next)
+	return vm.state.SetPrunedHeight(next)
+}
@@ -0,0 +1,116 @@
+package zapavm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/hashing"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+var errZcashUnavailable = errors.New("zcashd unavailable")
+
+// zblockClient serves zcash blocks from memory. Methods other than
+// GetZBlock aren't implemented.
+type zblockClient struct {
+	zclient.ZcashClient
+	zblocks map[int][]byte
+}
+
+func (zc *zblockClient) GetZBlock(height int) zclient.ZcashBlockResult {
+	zblk, ok := zc.zblocks[height]
+	if !ok {
+		return zclient.ZcashBlockResult{Error: errZcashUnavailable}
+	}
+	return zclient.ZcashBlockResult{Block: zblk}
+}
+
+// prunedTestBlock returns the pruned header of a block at [height] carrying
+// [zblk], marshalled with [codecVersion]
+func prunedTestBlock(t *testing.T, vm *VM, height uint64, zblk []byte, codecVersion uint16) *Block {
+	full := &Block{
+		PrntID:        ids.ID{1},
+		Hght:          height,
+		ZBlk:          zblk,
+		CreationTime:  1000,
+		ProducingNode: "node",
+	}
+	if codecVersion == legacyCodecVersion {
+		full.ZBlk = zclient.EncodeZBlock(zblk)
+	}
+	blkBytes, err := Codec.Marshal(codecVersion, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Block{
+		PrntID:        full.PrntID,
+		Hght:          full.Hght,
+		CreationTime:  full.CreationTime,
+		ProducingNode: full.ProducingNode,
+		id:            hashing.ComputeHash256Array(blkBytes),
+		vm:            vm,
+		codecVersion:  codecVersion,
+		pruned:        true,
+	}
+}
+
+func TestLoadPayload(t *testing.T) {
+	zblk := []byte{0x04, 0x00, 0x00, 0x00, 0xaa}
+	tests := []struct {
+		name         string
+		codecVersion uint16
+		served       map[int][]byte
+		wantErr      error
+	}{
+		{"raw block", CodecVersion, map[int][]byte{5: zblk}, nil},
+		{"legacy block", legacyCodecVersion, map[int][]byte{5: zblk}, nil},
+		{"different zcash block", CodecVersion, map[int][]byte{5: {0x04, 0x00, 0x00, 0x00, 0xbb}}, errPrunedPayloadMismatch},
+		{"different legacy zcash block", legacyCodecVersion, map[int][]byte{5: {0x01}}, errPrunedPayloadMismatch},
+		{"zcashd missing the block", CodecVersion, map[int][]byte{}, errZcashUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &VM{zc: &zblockClient{zblocks: test.served}}
+			blk := prunedTestBlock(t, vm, 5, zblk, test.codecVersion)
+
+			blkBytes, err := blk.LoadBytes()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("LoadBytes() error = %v, expected %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				if blkBytes != nil {
+					t.Fatal("LoadBytes() returned bytes with an error")
+				}
+				if blk.Bytes() != nil || blk.ZBlock() != nil {
+					t.Fatal("failed load left a payload on the block")
+				}
+				return
+			}
+			if hashing.ComputeHash256Array(blkBytes) != blk.ID() {
+				t.Fatal("loaded bytes don't hash to the block ID")
+			}
+			loaded, err := blk.LoadZBlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(loaded, zblk) {
+				t.Fatalf("LoadZBlock() = %x, expected %x", loaded, zblk)
+			}
+		})
+	}
+}
+
+func TestLoadPayloadUnpruned(t *testing.T) {
+	// zcashd isn't asked for blocks that weren't pruned
+	vm := &VM{zc: &zblockClient{}}
+	blk := &Block{Hght: 5, ZBlk: []byte{0x01}, bytes: []byte{0x02}, vm: vm}
+	blkBytes, err := blk.LoadBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(blkBytes, []byte{0x02}) {
+		t.Fatalf("LoadBytes() = %x, expected 02", blkBytes)
+	}
+}
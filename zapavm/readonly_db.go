@@ -0,0 +1,105 @@
+package zapavm
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/database/memdb"
+	"github.com/ava-labs/avalanchego/utils"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var errReadOnly = errors.New("database is opened read-only")
+
+var (
+	_ database.Database = &readOnlyLevelDB{}
+	_ database.Batch    = &readOnlyBatch{}
+	_ database.Iterator = &readOnlyIterator{}
+)
+
+// readOnlyLevelDB is a LevelDB database opened read-only. Every write to it
+// fails.
+type readOnlyLevelDB struct {
+	db *leveldb.DB
+}
+
+// levelDBError turns goleveldb's errors into the database package's
+func levelDBError(err error) error {
+	switch err {
+	case leveldb.ErrNotFound:
+		return database.ErrNotFound
+	case leveldb.ErrClosed:
+		return database.ErrClosed
+	default:
+		return err
+	}
+}
+
+func (db *readOnlyLevelDB) Has(key []byte) (bool, error) {
+	has, err := db.db.Has(key, nil)
+	return has, levelDBError(err)
+}
+
+func (db *readOnlyLevelDB) Get(key []byte) ([]byte, error) {
+	value, err := db.db.Get(key, nil)
+	return value, levelDBError(err)
+}
+
+func (db *readOnlyLevelDB) Put([]byte, []byte) error { return errReadOnly }
+
+func (db *readOnlyLevelDB) Delete([]byte) error { return errReadOnly }
+
+// NewBatch returns a batch that can be filled but not written
+func (db *readOnlyLevelDB) NewBatch() database.Batch {
+	return &readOnlyBatch{Batch: memdb.New().NewBatch()}
+}
+
+func (db *readOnlyLevelDB) NewIterator() database.Iterator {
+	return db.NewIteratorWithStartAndPrefix(nil, nil)
+}
+
+func (db *readOnlyLevelDB) NewIteratorWithStart(start []byte) database.Iterator {
+	return db.NewIteratorWithStartAndPrefix(start, nil)
+}
+
+func (db *readOnlyLevelDB) NewIteratorWithPrefix(prefix []byte) database.Iterator {
+	return db.NewIteratorWithStartAndPrefix(nil, prefix)
+}
+
+func (db *readOnlyLevelDB) NewIteratorWithStartAndPrefix(start, prefix []byte) database.Iterator {
+	keyRange := util.BytesPrefix(prefix)
+	if bytes.Compare(start, keyRange.Start) > 0 {
+		keyRange.Start = start
+	}
+	return &readOnlyIterator{Iterator: db.db.NewIterator(keyRange, nil)}
+}
+
+func (db *readOnlyLevelDB) Stat(property string) (string, error) {
+	value, err := db.db.GetProperty(property)
+	return value, levelDBError(err)
+}
+
+func (db *readOnlyLevelDB) Compact([]byte, []byte) error { return errReadOnly }
+
+func (db *readOnlyLevelDB) Close() error { return levelDBError(db.db.Close()) }
+
+func (db *readOnlyLevelDB) HealthCheck() (interface{}, error) { return nil, nil }
+
+// readOnlyIterator copies the keys and values goleveldb reuses between steps
+type readOnlyIterator struct {
+	iterator.Iterator
+}
+
+func (it *readOnlyIterator) Key() []byte { return utils.CopyBytes(it.Iterator.Key()) }
+
+func (it *readOnlyIterator) Value() []byte { return utils.CopyBytes(it.Iterator.Value()) }
+
+// readOnlyBatch rejects being written
+type readOnlyBatch struct {
+	database.Batch
+}
+
+func (b *readOnlyBatch) Write() error { return errReadOnly }
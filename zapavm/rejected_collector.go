@@ -0,0 +1,211 @@
+package zapavm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// rejected blocks more than this many blocks below the last accepted
+	// block are deleted by default
+	defaultRejectedGCDepth = 2048
+
+	defaultRejectedGCIntervalSeconds = 60
+
+	// default maximum number of rejected blocks deleted per run
+	defaultRejectedGCBatchSize = 256
+)
+
+// RejectedGCStats reports what the rejected block collector has done since
+// this node started
+type RejectedGCStats struct {
+	Runs            uint64    `json:"runs"`
+	BlocksCollected uint64    `json:"blocksCollected"`
+	Errors          uint64    `json:"errors"`
+	LastRun         time.Time `json:"lastRun"`
+	LastRunDuration string    `json:"lastRunDuration"`
+	// last height at which every rejected block has been collected
+	CollectedThrough uint64 `json:"collectedThrough"`
+}
+
+// checkRejectedGCConfig returns an error if the rejected block collector is
+// enabled with an interval or batch size it can't run with
+func checkRejectedGCConfig(conf ChainConfig) error {
+	if conf.RejectedGCDepth == 0 {
+		return nil
+	}
+	if conf.RejectedGCIntervalSeconds <= 0 {
+		return fmt.Errorf("rejectedGCIntervalSeconds must be positive when rejectedGCDepth is set, got %d", conf.RejectedGCIntervalSeconds)
+	}
+	if conf.RejectedGCBatchSize <= 0 {
+		return fmt.Errorf("rejectedGCBatchSize must be positive when rejectedGCDepth is set, got %d", conf.RejectedGCBatchSize)
+	}
+	return nil
+}
+
+// rejectedGCMetrics exports RejectedGCStats to the chain's metrics
+type rejectedGCMetrics struct {
+	runs             prometheus.Counter
+	blocksCollected  prometheus.Counter
+	errors           prometheus.Counter
+	lastRunDuration  prometheus.Gauge
+	collectedThrough prometheus.Gauge
+}
+
+// newRejectedGCMetrics registers the collector's metrics with the chain's
+// metrics, under namespace zapavm_rejected_gc
+func newRejectedGCMetrics(gatherer interface {
+	Register(prometheus.Gatherer) error
+}) (*rejectedGCMetrics, error) {
+	const namespace = "zapavm_rejected_gc"
+	m := &rejectedGCMetrics{
+		runs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs",
+			Help:      "Number of rejected block collector runs",
+		}),
+		blocksCollected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blocks_collected",
+			Help:      "Number of rejected blocks deleted",
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors",
+			Help:      "Number of rejected block collector runs that failed",
+		}),
+		lastRunDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_run_duration_seconds",
+			Help:      "Duration of the last rejected block collector run",
+		}),
+		collectedThrough: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "collected_through",
+			Help:      "Last height at which every rejected block has been deleted",
+		}),
+	}
+	registry := prometheus.NewRegistry()
+	for _, c := range []prometheus.Collector{m.runs, m.blocksCollected, m.errors, m.lastRunDuration, m.collectedThrough} {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, gatherer.Register(registry)
+}
+
+// CollectRejectedBlocks deletes up to [limit] rejected blocks with height
+// below [below] from the block database, recording in the rejected index
+// that they were collected. It returns the number of deleted blocks.
+func (s *state) CollectRejectedBlocks(below uint64, limit int) (int, error) {
+	from, after, err := s.RejectedIndex.GetCollectorCursor()
+	if err != nil {
+		return 0, err
+	}
+	if from >= below {
+		return 0, nil
+	}
+	infos, err := s.RejectedIndex.GetRejectedBlocksAfter(from, after, below, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	collected := 0
+	for _, info := range infos {
+		if info.Collected {
+			continue
+		}
+		if err := s.BlockState.DeleteBlock(info.ID); err != nil {
+			return collected, fmt.Errorf("error deleting rejected block %s: %w", info.ID, err)
+		}
+		if err := s.RejectedIndex.MarkCollected(info); err != nil {
+			return collected, err
+		}
+		collected++
+	}
+
+	// a full batch may have stopped partway through a height, so resume
+	// right after its last block, which keeps the collector moving however
+	// many blocks were rejected at one height. Otherwise everything below
+	// [below] is collected.
+	if len(infos) == limit {
+		last := infos[len(infos)-1]
+		return collected, s.RejectedIndex.SetCollectorCursor(last.Height, last.ID)
+	}
+	return collected, s.RejectedIndex.SetCollectorCursor(below, ids.Empty)
+}
+
+// runRejectedBlockCollector periodically deletes old rejected blocks until
+// the VM shuts down
+func (vm *VM) runRejectedBlockCollector() {
+	interval := time.Duration(vm.config.RejectedGCIntervalSeconds) * time.Second
+	log.Info("Starting rejected block collector", "depth", vm.config.RejectedGCDepth, "interval", interval, "batch size", vm.config.RejectedGCBatchSize)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-vm.shutdownChan:
+			return
+		case <-ticker.C:
+			if err := vm.collectRejectedBlocks(); err != nil {
+				log.Warn("Error collecting rejected blocks", "error", err)
+			}
+		}
+	}
+}
+
+// collectRejectedBlocks runs one bounded batch of the rejected block collector
+func (vm *VM) collectRejectedBlocks() error {
+	vm.ctx.Lock.Lock()
+	defer vm.ctx.Lock.Unlock()
+
+	// Shutdown may have closed the database while we waited for the lock
+	if vm.isShutdown() {
+		return nil
+	}
+
+	start := time.Now()
+	vm.gcStats.Runs++
+	vm.gcStats.LastRun = start
+	vm.gcMetrics.runs.Inc()
+
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		vm.gcStats.Errors++
+		vm.gcMetrics.errors.Inc()
+		return err
+	}
+	if lastAccepted.Height() <= vm.config.RejectedGCDepth {
+		return nil
+	}
+	below := lastAccepted.Height() - vm.config.RejectedGCDepth
+
+	collected, err := vm.state.CollectRejectedBlocks(below, vm.config.RejectedGCBatchSize)
+	if err == nil {
+		err = vm.state.Commit()
+	}
+	if err != nil {
+		vm.gcStats.Errors++
+		vm.gcMetrics.errors.Inc()
+		return err
+	}
+
+	duration := time.Since(start)
+	vm.gcStats.BlocksCollected += uint64(collected)
+	vm.gcStats.LastRunDuration = duration.String()
+	vm.gcMetrics.blocksCollected.Add(float64(collected))
+	vm.gcMetrics.lastRunDuration.Set(duration.Seconds())
+	if vm.gcStats.CollectedThrough, err = vm.state.GetCollectedHeight(); err != nil {
+		return err
+	}
+	vm.gcMetrics.collectedThrough.Set(float64(vm.gcStats.CollectedThrough))
+	if collected > 0 {
+		log.Info("Collected rejected blocks", "count", collected, "through height", vm.gcStats.CollectedThrough, "duration", vm.gcStats.LastRunDuration)
+	}
+	return nil
+}
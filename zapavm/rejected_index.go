@@ -0,0 +1,188 @@
+package zapavm
+
+import (
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+const (
+	collectorHeightByte byte = iota
+)
+
+// persists where the rejected block collector resumes from with this key
+var collectorHeightKey = []byte{collectorHeightByte}
+
+var _ RejectedIndex = &rejectedIndex{}
+
+// RejectedIndex keeps a compact record of every rejected block by height.
+// Records outlive the blocks themselves, which are garbage collected once
+// they fall far enough below the last accepted block.
+type RejectedIndex interface {
+	PutRejectedBlock(blk *Block) error
+	// GetRejectedBlocks returns up to [limit] rejected blocks with
+	// [from] <= height < [to], in height order
+	GetRejectedBlocks(from uint64, to uint64, limit int) ([]RejectedBlockInfo, error)
+	// GetRejectedBlocksAfter is GetRejectedBlocks starting right after the
+	// block [blkID] at [height] rather than at the start of a height
+	GetRejectedBlocksAfter(height uint64, blkID ids.ID, to uint64, limit int) ([]RejectedBlockInfo, error)
+	MarkCollected(info RejectedBlockInfo) error
+
+	// GetCollectedHeight returns the last height at which the collector has
+	// deleted every rejected block
+	GetCollectedHeight() (uint64, error)
+	// GetCollectorCursor returns the last rejected block the collector
+	// looked at. It resumes right after it. An empty ID means it resumes at
+	// the start of [height].
+	GetCollectorCursor() (height uint64, blkID ids.ID, err error)
+	SetCollectorCursor(height uint64, blkID ids.ID) error
+}
+
+// RejectedBlockInfo is what the rejected index records about a rejected block
+type RejectedBlockInfo struct {
+	ID            ids.ID `json:"id"`
+	ParentID      ids.ID `json:"parentID"`
+	Height        uint64 `json:"height"`
+	CreationTime  int64  `json:"creationTime"`
+	ProducingNode string `json:"producingNode"`
+	// whether the block itself has been deleted from the block database
+	Collected bool `json:"collected"`
+}
+
+// rejectedEntry is the value stored in the rejected index. The height and
+// ID of the block make up the key.
+type rejectedEntry struct {
+	PrntID        ids.ID `serialize:"true"`
+	CreationTime  int64  `serialize:"true"`
+	ProducingNode string `serialize:"true"`
+	Collected     bool   `serialize:"true"`
+}
+
+type rejectedIndex struct {
+	db database.Database
+}
+
+// NewRejectedIndex returns a RejectedIndex stored in [db]
+func NewRejectedIndex(db database.Database) RejectedIndex {
+	return &rejectedIndex{db: db}
+}
+
+// rejectedKey orders entries by height, so ranges below a height can be walked in order
+func rejectedKey(height uint64, blkID ids.ID) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, wrappers.LongLen+len(blkID))}
+	p.PackLong(height)
+	p.PackFixedBytes(blkID[:])
+	return p.Bytes
+}
+
+func (r *rejectedIndex) PutRejectedBlock(blk *Block) error {
+	return r.put(RejectedBlockInfo{
+		ID:            blk.ID(),
+		ParentID:      blk.Parent(),
+		Height:        blk.Height(),
+		CreationTime:  blk.CreationTime,
+		ProducingNode: blk.ProducingNode,
+	})
+}
+
+func (r *rejectedIndex) MarkCollected(info RejectedBlockInfo) error {
+	info.Collected = true
+	return r.put(info)
+}
+
+func (r *rejectedIndex) put(info RejectedBlockInfo) error {
+	entryBytes, err := Codec.Marshal(CodecVersion, &rejectedEntry{
+		PrntID:        info.ParentID,
+		CreationTime:  info.CreationTime,
+		ProducingNode: info.ProducingNode,
+		Collected:     info.Collected,
+	})
+	if err != nil {
+		return err
+	}
+	return r.db.Put(rejectedKey(info.Height, info.ID), entryBytes)
+}
+
+func (r *rejectedIndex) GetRejectedBlocks(from uint64, to uint64, limit int) ([]RejectedBlockInfo, error) {
+	return r.getRejectedBlocks(rejectedKey(from, ids.Empty), to, limit)
+}
+
+func (r *rejectedIndex) GetRejectedBlocksAfter(height uint64, blkID ids.ID, to uint64, limit int) ([]RejectedBlockInfo, error) {
+	after := rejectedKey(height, blkID)
+	// the smallest key greater than [after] is [after] followed by a zero byte
+	return r.getRejectedBlocks(append(after, 0), to, limit)
+}
+
+// getRejectedBlocks returns up to [limit] rejected blocks with keys from
+// [start] and height below [to]
+func (r *rejectedIndex) getRejectedBlocks(start []byte, to uint64, limit int) ([]RejectedBlockInfo, error) {
+	it := r.db.NewIteratorWithStart(start)
+	defer it.Release()
+
+	infos := []RejectedBlockInfo{}
+	for len(infos) < limit && it.Next() {
+		key := it.Key()
+		// skip singleton keys such as collectorHeightKey
+		if len(key) != wrappers.LongLen+len(ids.Empty) {
+			continue
+		}
+		p := wrappers.Packer{Bytes: key}
+		height := p.UnpackLong()
+		if height >= to {
+			break
+		}
+		blkID, err := ids.ToID(p.UnpackFixedBytes(len(ids.Empty)))
+		if err != nil {
+			return nil, err
+		}
+		entry := rejectedEntry{}
+		if _, err := Codec.Unmarshal(it.Value(), &entry); err != nil {
+			return nil, err
+		}
+		infos = append(infos, RejectedBlockInfo{
+			ID:            blkID,
+			ParentID:      entry.PrntID,
+			Height:        height,
+			CreationTime:  entry.CreationTime,
+			ProducingNode: entry.ProducingNode,
+			Collected:     entry.Collected,
+		})
+	}
+	return infos, it.Error()
+}
+
+// The collector resumes at or partway through the cursor's height, so only
+// the heights below it are fully collected
+func (r *rejectedIndex) GetCollectedHeight() (uint64, error) {
+	height, _, err := r.GetCollectorCursor()
+	if err != nil || height == 0 {
+		return 0, err
+	}
+	return height - 1, nil
+}
+
+func (r *rejectedIndex) GetCollectorCursor() (uint64, ids.ID, error) {
+	cursor, err := r.db.Get(collectorHeightKey)
+	if err == database.ErrNotFound {
+		return 0, ids.Empty, nil
+	}
+	if err != nil {
+		return 0, ids.Empty, err
+	}
+	// older versions only stored the height to resume from
+	if len(cursor) == wrappers.LongLen {
+		height, err := database.ParseUInt64(cursor)
+		return height, ids.Empty, err
+	}
+	p := wrappers.Packer{Bytes: cursor}
+	height := p.UnpackLong()
+	blkID, err := ids.ToID(p.UnpackFixedBytes(len(ids.Empty)))
+	if p.Errored() {
+		return 0, ids.Empty, p.Err
+	}
+	return height, blkID, err
+}
+
+func (r *rejectedIndex) SetCollectorCursor(height uint64, blkID ids.ID) error {
+	return r.db.Put(collectorHeightKey, rejectedKey(height, blkID))
+}
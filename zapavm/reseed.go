@@ -0,0 +1,158 @@
+package zapavm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// DefaultReseedBatchSize is the number of blocks ReseedZcash submits between
+// checking zcashd's height
+const DefaultReseedBatchSize = 500
+
+var errReseedAhead = errors.New("zcashd is ahead of the last accepted block")
+
+// ReseedOptions configure ReseedZcash
+type ReseedOptions struct {
+	// BatchSize is the number of blocks submitted between checking that
+	// zcashd took them. Defaults to DefaultReseedBatchSize.
+	BatchSize uint64
+	// Progress, if set, is called after every batch
+	Progress func(ReseedProgress)
+}
+
+// ReseedProgress reports how far ReseedZcash has got
+type ReseedProgress struct {
+	Height       uint64        `json:"height"` // zcashd's height
+	TargetHeight uint64        `json:"targetHeight"`
+	Submitted    uint64        `json:"submitted"` // blocks submitted by this run
+	Elapsed      time.Duration `json:"elapsed"`
+}
+
+// ReseedResult is the result of ReseedZcash
+type ReseedResult struct {
+	StartHeight  uint64 `json:"startHeight"` // first height submitted, after the blocks zcashd already had
+	TargetHeight uint64 `json:"targetHeight"`
+	Submitted    uint64 `json:"submitted"`
+	Verified     uint64 `json:"verified"` // heights whose getblockhash matched the accepted chain
+}
+
+// ReseedZcash rebuilds zcashd's chain from the VM's accepted chain. zcashd
+// must start with only its genesis block, which has to match the VM's, or be
+// partway through an earlier reseed: the blocks it already has are checked
+// against the accepted chain and submitting resumes above them. Every
+// accepted zcash block above zcashd's height is then submitted in batches,
+// and once zcashd reaches the last accepted block its whole getblockhash
+// chain is checked against the accepted chain.
+//
+// The zcash blocks being submitted must not have been pruned, since zcashd
+// is where pruned blocks are fetched from.
+func (vm *VM) ReseedZcash(opts ReseedOptions) (ReseedResult, error) {
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultReseedBatchSize
+	}
+	result := ReseedResult{}
+
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return result, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	result.TargetHeight = lastAccepted.Height()
+
+	zcBlkCount, err := vm.zc.GetBlockCount()
+	if err != nil {
+		return result, fmt.Errorf("error getting zcashd's block count: %w", err)
+	}
+	zcHeight := uint64(zcBlkCount)
+	if zcHeight > result.TargetHeight {
+		return result, fmt.Errorf("%w: zcashd is at height %d and the last accepted block at %d", errReseedAhead, zcHeight, result.TargetHeight)
+	}
+	// the blocks zcashd already has must be ours. Checking the top one is
+	// enough, since each zcash block commits to its parent.
+	if err := vm.checkZcashHashAt(zcHeight); err != nil {
+		return result, fmt.Errorf("zcashd can't be reseeded from this chain: %w", err)
+	}
+	result.StartHeight = zcHeight + 1
+
+	prunedHeight, err := vm.state.GetPrunedHeight()
+	if err != nil {
+		return result, err
+	}
+	if result.StartHeight <= result.TargetHeight && result.StartHeight < prunedHeight {
+		return result, fmt.Errorf("blocks below height %d are pruned and can't be submitted from height %d", prunedHeight, result.StartHeight)
+	}
+
+	log.Info("Reseeding zcashd", "from", result.StartHeight, "to", result.TargetHeight, "batchSize", opts.BatchSize)
+	start := time.Now()
+	for height := result.StartHeight; height <= result.TargetHeight; {
+		end := height + opts.BatchSize
+		if end > result.TargetHeight+1 {
+			end = result.TargetHeight + 1
+		}
+		for ; height < end; height++ {
+			blk, err := vm.GetBlockAtHeight(height)
+			if err != nil {
+				return result, err
+			}
+			zblk, err := blk.LoadZBlock()
+			if err != nil {
+				return result, err
+			}
+			if err := vm.zc.SubmitBlock(zblk); err != nil {
+				return result, fmt.Errorf("error submitting block at height %d: %w", height, err)
+			}
+			result.Submitted++
+		}
+
+		// submitblock reports some rejections in its result rather than as an
+		// error, so check that zcashd's chain grew by the whole batch
+		zcBlkCount, err := vm.zc.GetBlockCount()
+		if err != nil {
+			return result, fmt.Errorf("error getting zcashd's block count: %w", err)
+		}
+		if uint64(zcBlkCount) != end-1 {
+			return result, fmt.Errorf("zcashd is at height %d after submitting blocks through height %d", zcBlkCount, end-1)
+		}
+		if opts.Progress != nil {
+			opts.Progress(ReseedProgress{
+				Height:       end - 1,
+				TargetHeight: result.TargetHeight,
+				Submitted:    result.Submitted,
+				Elapsed:      time.Since(start),
+			})
+		}
+	}
+
+	log.Info("Verifying reseeded zcashd chain", "height", result.TargetHeight)
+	for height := uint64(0); height <= result.TargetHeight; height++ {
+		if err := vm.checkZcashHashAt(height); err != nil {
+			return result, err
+		}
+		result.Verified++
+	}
+	log.Info("Reseeded zcashd", "submitted", result.Submitted, "verified", result.Verified, "elapsed", time.Since(start))
+	return result, nil
+}
+
+// checkZcashHashAt checks that zcashd's block at [height] is the zcash block
+// of the accepted block at [height]
+func (vm *VM) checkZcashHashAt(height uint64) error {
+	blk, err := vm.GetBlockAtHeight(height)
+	if err != nil {
+		return err
+	}
+	expected, err := blk.ZcashHash()
+	if err != nil {
+		return err
+	}
+	zhash, err := vm.zc.GetBlockHash(int(height))
+	if err != nil {
+		return fmt.Errorf("error getting zcashd's block hash at height %d: %w", height, err)
+	}
+	if zhash != expected {
+		return fmt.Errorf("zcashd has block %s at height %d rather than %s", zhash, height, expected)
+	}
+	return nil
+}
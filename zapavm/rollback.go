@@ -0,0 +1,194 @@
+package zapavm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	log "github.com/inconshreveable/log15"
+)
+
+var (
+	errRollbackAboveTip    = errors.New("cannot roll back to a height above the last accepted block")
+	errRollbackPruned      = errors.New("cannot roll back over pruned blocks")
+	errRollbackWhileOnline = errors.New("cannot roll back while the consensus engine is running, restart the node with maintenanceMode or stop it and use the rollback command")
+	errMaintenanceMode     = errors.New("chain is in maintenance mode")
+)
+
+// RollbackPlan describes what rolling the accepted chain back to Height
+// drops, or dropped
+type RollbackPlan struct {
+	Height             uint64            `json:"height"`
+	BlockID            ids.ID            `json:"blockID"` // block that becomes the last accepted block
+	LastAcceptedHeight uint64            `json:"lastAcceptedHeight"`
+	LastAcceptedID     ids.ID            `json:"lastAcceptedID"`
+	Dropped            []RolledBackBlock `json:"dropped"`
+}
+
+// RolledBackBlock is an accepted block dropped by a rollback
+type RolledBackBlock struct {
+	Height        uint64 `json:"height"`
+	ID            ids.ID `json:"id"`
+	ProducingNode string `json:"producingNode"`
+}
+
+// PlanRollback lists the accepted blocks that rolling back to [height] would drop
+func (vm *VM) PlanRollback(height uint64) (RollbackPlan, error) {
+	plan := RollbackPlan{Height: height}
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return plan, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	plan.LastAcceptedHeight = lastAccepted.Height()
+	plan.LastAcceptedID = lastAccepted.ID()
+	if height > lastAccepted.Height() {
+		return plan, errRollbackAboveTip
+	}
+	if plan.BlockID, err = vm.state.GetBlockIDAtHeight(height); err != nil {
+		return plan, fmt.Errorf("error getting block at height %d: %w", height, err)
+	}
+	// pruned blocks are reloaded from zcashd's active chain by height, which
+	// no longer holds them once zcashd is rolled back
+	prunedHeight, err := vm.state.GetPrunedHeight()
+	if err != nil {
+		return plan, err
+	}
+	if prunedHeight > height+1 {
+		return plan, fmt.Errorf("%w: blocks below height %d are pruned, roll back to height %d or above", errRollbackPruned, prunedHeight, prunedHeight-1)
+	}
+
+	plan.Dropped = []RolledBackBlock{}
+	for h := height + 1; h <= lastAccepted.Height(); h++ {
+		blk, err := vm.GetBlockAtHeight(h)
+		if err != nil {
+			return plan, err
+		}
+		plan.Dropped = append(plan.Dropped, RolledBackBlock{
+			Height:        h,
+			ID:            blk.ID(),
+			ProducingNode: blk.ProducingNode,
+		})
+	}
+	return plan, nil
+}
+
+// Rollback rewinds the accepted chain to [height]. Accepted blocks above it
+// are deleted and zcashd is rolled back to match. With [dryRun] set nothing
+// is changed and the plan is only returned. Only offline VMs, or VMs in
+// maintenance mode, whose engine can't accept blocks, can be rolled back.
+func (vm *VM) Rollback(height uint64, dryRun bool) (RollbackPlan, error) {
+	plan, err := vm.PlanRollback(height)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	if vm.online && !vm.config.MaintenanceMode {
+		return plan, errRollbackWhileOnline
+	}
+	if len(plan.Dropped) == 0 {
+		log.Info("Rollback: chain is already at the requested height", "height", height)
+		return plan, nil
+	}
+	log.Warn("Rollback: begin", "to height", height, "from height", plan.LastAcceptedHeight, "dropped blocks", len(plan.Dropped))
+
+	// roll zcashd back first so a failure leaves the VM's chain untouched
+	invalidated, err := vm.rollbackZcash(height)
+	if err != nil {
+		return plan, err
+	}
+	if invalidated != "" {
+		if err := vm.state.PutRolledBackZcash(invalidated); err != nil {
+			return plan, err
+		}
+	}
+
+	// newest first, so each producer's statistics unwind in order
+	for i := len(plan.Dropped) - 1; i >= 0; i-- {
+		dropped := plan.Dropped[i]
+		// zcashd still serves invalidated blocks by hash, so their
+		// transactions can be listed for unindexing
+		blk, err := vm.getBlock(dropped.ID)
+		if err != nil {
+			return plan, err
+		}
+		if err := vm.unindexAcceptedBlock(blk); err != nil {
+			return plan, fmt.Errorf("error unindexing block %s: %w", dropped.ID, err)
+		}
+		if err := vm.state.DeleteBlockIDAtHeight(dropped.Height); err != nil {
+			return plan, fmt.Errorf("error removing height index entry %d: %w", dropped.Height, err)
+		}
+		if err := vm.state.DeleteBlock(dropped.ID); err != nil {
+			return plan, fmt.Errorf("error deleting block %s: %w", dropped.ID, err)
+		}
+		log.Info("Rollback: dropped block", "height", dropped.Height, "id", dropped.ID)
+	}
+	if err := vm.state.SetLastAccepted(plan.BlockID); err != nil {
+		return plan, err
+	}
+	// blocks built on the dropped chain can never be accepted
+	vm.verifiedBlocks = make(map[ids.ID]*Block)
+	vm.preferred = plan.BlockID
+
+	if err := vm.state.Commit(); err != nil {
+		return plan, err
+	}
+	log.Warn("Rollback: finished", "last accepted height", height, "last accepted id", plan.BlockID)
+	return plan, nil
+}
+
+// rollbackZcash invalidates zcashd's block at [height]+1, which rolls its
+// active chain back to [height]. It returns the hash of the invalidated
+// block, or "" if zcashd was already at or below [height].
+func (vm *VM) rollbackZcash(height uint64) (string, error) {
+	if vm.config.MockZcash {
+		return "", nil
+	}
+	zcBlkCount, err := vm.zc.GetBlockCount()
+	if err != nil {
+		return "", fmt.Errorf("error getting zcash block count: %w", err)
+	}
+	var hash string
+	if uint64(zcBlkCount) > height {
+		if hash, err = vm.zc.GetBlockHash(int(height) + 1); err != nil {
+			return "", fmt.Errorf("error getting zcash block hash at height %d: %w", height+1, err)
+		}
+		log.Info("Rollback: invalidating zcash block", "height", height+1, "hash", hash)
+		if err := vm.zc.InvalidateBlock(hash); err != nil {
+			return "", fmt.Errorf("error invalidating zcash block %s: %w", hash, err)
+		}
+		if zcBlkCount, err = vm.zc.GetBlockCount(); err != nil {
+			return hash, fmt.Errorf("error getting zcash block count: %w", err)
+		}
+	}
+	// a zcashd that is behind is caught up by initAndSync on the next start
+	if uint64(zcBlkCount) > height {
+		return hash, fmt.Errorf("zcash is at height %d rather than %d after rolling back", zcBlkCount, height)
+	}
+	return hash, nil
+}
+
+// reconsiderRolledBackZcash clears the invalid flag a rollback set on
+// [blk]'s zcash block, now that consensus accepted it again. That also
+// revalidates the dropped blocks built on it, which consensus hasn't
+// accepted again, so zcashd's next block is invalidated in its place.
+func (vm *VM) reconsiderRolledBackZcash(blk *Block) error {
+	zhash, err := blk.ZcashHash()
+	if err != nil {
+		return err
+	}
+	rolledBack, err := vm.state.HasRolledBackZcash(zhash)
+	if err != nil || !rolledBack {
+		return err
+	}
+	log.Info("Reconsidering rolled back zcash block", append(blk.LogInfo(), "hash", zhash)...)
+	if err := vm.zc.ReconsiderBlock(zhash); err != nil {
+		return fmt.Errorf("error reconsidering zcash block %s: %w", zhash, err)
+	}
+	if err := vm.state.DeleteRolledBackZcash(zhash); err != nil {
+		return err
+	}
+	invalidated, err := vm.rollbackZcash(blk.Height())
+	if err != nil || invalidated == "" {
+		return err
+	}
+	return vm.state.PutRolledBackZcash(invalidated)
+}
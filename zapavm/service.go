@@ -4,20 +4,36 @@
 package zapavm
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
 
+	"github.com/ava-labs/avalanchego/database"
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/utils/json"
 	log "github.com/inconshreveable/log15"
-	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+const (
+	// maximum number of rejected blocks returned by GetRejectedBlocks
+	maxRejectedBlocksPerRequest = 1024
+	// maximum number of blocks returned by GetBlocksInTimeRange
+	maxTimedBlocksPerRequest = 1024
+	// maximum number of blocks returned by GetBlocks
+	maxBlocksPerRequest = 100
+	// maximum number of dead letters returned by GetWebhookDeadLetters
+	maxDeadLettersPerRequest = 1024
 )
 
 var (
 	errBadData               = errors.New("data must be base 58 repr. of 32 bytes")
 	errNoSuchBlock           = errors.New("couldn't get block from database. Does it exist?")
 	errCannotGetLastAccepted = errors.New("problem getting last accepted")
+	errAdminAPIDisabled      = errors.New("admin API is disabled. Set adminAPIEnabled in the chain config to enable it")
 )
 
 // Service is the API service for this VM
@@ -37,7 +53,9 @@ type SubmitTxArgs struct {
 
 type NodeBlockCountRequest struct {
 	FromHeight *int `json:"fromHeight,omitempty"` // inclusive
-	ToHeight   *int `json:"toHeight,omitempty"` // exclusive
+	ToHeight   *int `json:"toHeight,omitempty"` // inclusive, unlike ProducerStatsArgs.ToHeight
+	FromTime   *int64 `json:"fromTime,omitempty"` // unix seconds, inclusive. Rounded down to the hour
+	ToTime     *int64 `json:"toTime,omitempty"` // unix seconds, exclusive. Rounded up to the hour
 }
 
 type GetBlockRequest struct {
@@ -64,18 +82,82 @@ type SuccessReply struct {
 	Success bool
 }
 
+// EnabledReply is whether the chain is enabled, why, and since when
 type EnabledReply struct {
-	Enabled bool
+	ChainEnablement
+}
+
+// SetChainEnabledArgs are the arguments to SetChainEnabled
+type SetChainEnabledArgs struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
 }
 
 type NodeBlockCountReply struct {
 	NodeBlockCounts map[string]int 
+	Producers       map[string]ProducerStats `json:"producers"`
+}
+
+// ProducerStatsArgs are the arguments to ProducerStats. A range is given
+// either by height or by time.
+type ProducerStatsArgs struct {
+	NodeID     string  `json:"nodeID"` // only report this node. Defaults to every node
+	FromHeight *uint64 `json:"fromHeight,omitempty"` // inclusive
+	ToHeight   *uint64 `json:"toHeight,omitempty"` // exclusive
+	FromTime   *int64  `json:"fromTime,omitempty"` // unix seconds, inclusive. Rounded down to the hour
+	ToTime     *int64  `json:"toTime,omitempty"` // unix seconds, exclusive. Rounded up to the hour
+	Interval   string  `json:"interval"` // "hour" or "day" to also break the range down by time
+}
+
+// ProducerStatsReply is the reply from ProducerStats
+type ProducerStatsReply struct {
+	Producers map[string]ProducerStats `json:"producers"`
+	Buckets   []ProducerBucket         `json:"buckets,omitempty"`
 }
 
 type BlockCountReply struct {
 	Blocks int
 }
 
+// GetRejectedBlocksArgs are the arguments to GetRejectedBlocks
+type GetRejectedBlocksArgs struct {
+	FromHeight uint64 `json:"fromHeight"` // inclusive
+	ToHeight   *uint64 `json:"toHeight,omitempty"` // exclusive. Defaults to no upper bound
+	Limit      int    `json:"limit"`
+}
+
+// GetRejectedBlocksReply is the reply from GetRejectedBlocks
+type GetRejectedBlocksReply struct {
+	Blocks []RejectedBlockInfo `json:"blocks"`
+}
+
+// PlanRollbackArgs are the arguments to PlanRollback
+type PlanRollbackArgs struct {
+	Height uint64 `json:"height"`
+}
+
+// RollbackChainArgs are the arguments to RollbackChain
+type RollbackChainArgs struct {
+	Height uint64 `json:"height"`
+	// ID of the block at Height, as reported by planRollback, so a rollback
+	// can't target the wrong block by mistake
+	Confirm ids.ID `json:"confirm"`
+}
+
+// RollbackChainReply is the reply from RollbackChain
+type RollbackChainReply struct {
+	RollbackPlan
+	// the consensus engine still remembers the dropped blocks, so the node
+	// must be restarted after a rollback
+	RestartRequired bool `json:"restartRequired"`
+}
+
+// BlockStorageStatsReply is the reply from BlockStorageStats
+type BlockStorageStatsReply struct {
+	Compression string `json:"compression"` // compression applied to newly written blocks
+	StorageStats
+}
+
 
 // GetBlockArgs are the arguments to GetBlock
 type GetBlockArgs struct {
@@ -84,33 +166,30 @@ type GetBlockArgs struct {
 	ID *ids.ID `json:"id"`
 
 	Height *int `json:"height"`
+
+	// encoding of the reply's data: hex, base64 or json. Defaults to hex
+	Encoding string `json:"encoding"`
 }
 
 // GetBlockReply is the reply from GetBlock
 type GetBlockReply struct {
 	Timestamp json.Uint64 `json:"timestamp"` // Timestamp of most recent block
-	Data      string      `json:"data"`      // Data in the most recent block. Base 58 repr. of 5 bytes.
+	Data      interface{} `json:"data"`      // the block's bytes in Encoding, or its fields if Encoding is json
+	Encoding  string      `json:"encoding"`
 	ID        ids.ID      `json:"id"`        // String repr. of ID of the most recent block
 	ParentID  ids.ID      `json:"parentID"`  // String repr. of ID of the most recent block's parent
+	Height    json.Uint64 `json:"height"`
+	Status    string      `json:"status"`
+	ZcashHash string      `json:"zcashHash"` // hash of the zcash block, as zcashd displays it
+	Size      json.Uint64 `json:"size"`      // length of the block's bytes
 	ProducingNode string `json:"producingNode"`
+	ZBlock    string      `json:"zblock"`    // Hex repr. of the zcash block, as zcashd serializes it
+	Pruned    bool        `json:"pruned"`    // Whether the zcash block was fetched from zcashd because this node pruned it
+	Error     string      `json:"error,omitempty"` // why the zcash block couldn't be loaded or hashed, if it couldn't
 }
 
 
 
-func (s *Service) SubmitTx(_ *http.Request, args *SubmitTxArgs, reply *GetMempoolReply) error {
-	log.Debug("SubmitTx: begin", "from", args.From, "to", args.To, "amount", args.Amount)
-	result := s.vm.zc.SendMany(args.From, args.To, args.Amount)
-	if result.Error != nil {
-		return result.Error.Error()
-	} else {
-		s.vm.as.SendAppGossip(result.Result)
-		s.vm.NotifyBlockReady()
-		reply.SubmittedTx = result.Result
-		reply.Mempool = nil
-	}
-	return nil
-}
-
 func (s *Service) GetBlockCount(_ *http.Request, args *EmptyArgs, reply *BlockCountReply) error {
 	log.Debug("GetBlockCount: begin")
 	b, e := s.vm.state.GetLastAcceptedBlock()
@@ -121,61 +200,240 @@ func (s *Service) GetBlockCount(_ *http.Request, args *EmptyArgs, reply *BlockCo
 	return nil
 }
 
-// tells the vm to mine a new block. will usually (but not 100%) cause this node to mine
-func (s *Service) MineBlock(_ *http.Request, args *EmptyArgs, reply *SuccessReply) error {
-	log.Debug("MineBlock: begin")
-	if !TestNet {
-		return errors.New("MineBlock can only be used on testnet and we are not on testnet")
-	} 
-	s.vm.NotifyBlockReady()
-	reply.Success = true
+// BlockStorageStats reports the compression ratio and bytes on disk of stored blocks
+func (s *Service) BlockStorageStats(_ *http.Request, args *EmptyArgs, reply *BlockStorageStatsReply) error {
+	log.Debug("BlockStorageStats: begin")
+	stats, err := s.vm.state.StorageStats()
+	if err != nil {
+		return fmt.Errorf("Error computing storage stats %e", err)
+	}
+	reply.Compression = s.vm.config.BlockCompression
+	reply.StorageStats = stats
 	return nil
 }
 
-func (s *Service) Zcashrpc(_ *http.Request, args *zclient.ZCashRequest, reply *zclient.ZCashResponse) error {
-	log.Debug("Zcashrpc: begin", "method", args.Method)
-	result := s.vm.zc.CallZcashJson(args.Method, args.Params)
-	reply.Result = result.Result
-	reply.ID = result.ID
-	reply.Error = result.Error
-	if reply.Error != nil {
-		return reply.Error.Error()
+// GetRejectedBlocks lists rejected blocks from the rejected index, including
+// ones the collector has since deleted from the block database
+func (s *Service) GetRejectedBlocks(_ *http.Request, args *GetRejectedBlocksArgs, reply *GetRejectedBlocksReply) error {
+	log.Debug("GetRejectedBlocks: begin", "from height", args.FromHeight, "to height", args.ToHeight, "limit", args.Limit)
+	to := uint64(math.MaxUint64)
+	if args.ToHeight != nil {
+		to = *args.ToHeight
+	}
+	limit := args.Limit
+	if limit <= 0 || limit > maxRejectedBlocksPerRequest {
+		limit = maxRejectedBlocksPerRequest
+	}
+	blocks, err := s.vm.state.GetRejectedBlocks(args.FromHeight, to, limit)
+	if err != nil {
+		return fmt.Errorf("Error reading rejected index %e", err)
 	}
+	reply.Blocks = blocks
+	return nil
+}
+
+// RejectedGCStats reports what the rejected block collector has done since this node started
+func (s *Service) RejectedGCStats(_ *http.Request, args *EmptyArgs, reply *RejectedGCStats) error {
+	log.Debug("RejectedGCStats: begin")
+	*reply = s.vm.gcStats
 	return nil
 }
 
+// PlanRollback lists the accepted blocks that rolling back to [args.Height]
+// would drop
+func (s *Service) PlanRollback(_ *http.Request, args *PlanRollbackArgs, reply *RollbackPlan) error {
+	log.Debug("PlanRollback: begin", "height", args.Height)
+	plan, err := s.vm.PlanRollback(args.Height)
+	*reply = plan
+	return err
+}
+
+// RollbackChain rewinds this node's accepted chain, and its zcashd, to
+// [args.Height]. The chain must be in maintenance mode. Admin only.
+func (s *Service) RollbackChain(_ *http.Request, args *RollbackChainArgs, reply *RollbackChainReply) error {
+	log.Debug("RollbackChain: begin", "height", args.Height, "confirm", args.Confirm)
+	if !s.vm.config.AdminAPIEnabled {
+		return errAdminAPIDisabled
+	}
+	if !s.vm.config.MaintenanceMode {
+		return errRollbackWhileOnline
+	}
+	plan, err := s.vm.PlanRollback(args.Height)
+	if err != nil {
+		return err
+	}
+	if args.Confirm != plan.BlockID {
+		return fmt.Errorf("confirm must be set to %s, the ID of the block at height %d", plan.BlockID, args.Height)
+	}
+	plan, err = s.vm.Rollback(args.Height, false)
+	reply.RollbackPlan = plan
+	reply.RestartRequired = err == nil && len(plan.Dropped) > 0
+	return err
+}
+
 func (s *Service) IsChainEnabled(_ *http.Request, args *EmptyArgs, reply *EnabledReply) error {
 	log.Debug("IsChainEnabled: begin", "nodeid", s.vm.ctx.NodeID)
-	reply.Enabled = s.vm.enabled
+	reply.ChainEnablement = s.vm.Enablement()
 	return nil
 }
 
-// associate with new zcash host and port
-func (s *Service) AssociateZcashHostPort(_ *http.Request, args *ZcashHostInfo, reply *SuccessReply) error {
-	log.Debug("AssociateZcashHostPort: begin", "rpc host", args.Host, "rpc port", args.Port)
-	s.vm.zc.SetHost(args.Host)
-	s.vm.zc.SetPort(args.Port)
-	reply.Success = true
+// SetChainEnabled enables or disables the chain until the node restarts. A
+// disabled chain stops building blocks and reports unhealthy. Admin only.
+func (s *Service) SetChainEnabled(_ *http.Request, args *SetChainEnabledArgs, reply *EnabledReply) error {
+	log.Debug("SetChainEnabled: begin", "enabled", args.Enabled, "reason", args.Reason)
+	if !s.vm.config.AdminAPIEnabled {
+		return errAdminAPIDisabled
+	}
+	if !args.Enabled && args.Reason == "" {
+		return errors.New("a reason is required to disable the chain")
+	}
+	s.vm.SetEnabled(args.Enabled, args.Reason)
+	reply.ChainEnablement = s.vm.Enablement()
 	return nil
 }
 
 func (s *Service) NodeBlockCounts(_ *http.Request, args *NodeBlockCountRequest, reply *NodeBlockCountReply) error {
-	log.Debug("NodeBlockCounts: begin", "from height", args.FromHeight, "to height", args.ToHeight)
-	reply.NodeBlockCounts = make(map[string]int)
-	for blk := range s.vm.BlockGenerator(args.FromHeight, args.ToHeight) {
-		if blk.ProducingNode != "" {		
-			reply.NodeBlockCounts[blk.ProducingNode]++
+	log.Debug("NodeBlockCounts: begin", "from height", args.FromHeight, "to height", args.ToHeight, "from time", args.FromTime, "to time", args.ToTime)
+	fromHeight, err := optionalHeight(args.FromHeight)
+	if err != nil {
+		return err
+	}
+	toHeight, err := optionalHeight(args.ToHeight)
+	if err != nil {
+		return err
+	}
+	// toHeight has always included the block at that height, while
+	// producerStats takes an exclusive bound. No bound is past MaxUint64.
+	if toHeight != nil {
+		if *toHeight == math.MaxUint64 {
+			toHeight = nil
+		} else {
+			to := *toHeight + 1
+			toHeight = &to
 		}
 	}
+	producers, err := s.producerStats(fromHeight, toHeight, args.FromTime, args.ToTime)
+	if err != nil {
+		return err
+	}
+	reply.NodeBlockCounts = make(map[string]int, len(producers))
+	for producer, stats := range producers {
+		reply.NodeBlockCounts[producer] = int(stats.Count)
+	}
+	reply.Producers = producers
 	return nil
 }
 
+// optionalHeight converts an optional height argument to a height
+func optionalHeight(height *int) (*uint64, error) {
+	if height == nil {
+		return nil, nil
+	}
+	if *height < 0 {
+		return nil, fmt.Errorf("height %d is negative", *height)
+	}
+	h := uint64(*height)
+	return &h, nil
+}
+
+// ProducerStats reports how many blocks each node produced, and the first
+// and last of them, over a height or time range
+func (s *Service) ProducerStats(_ *http.Request, args *ProducerStatsArgs, reply *ProducerStatsReply) error {
+	log.Debug("ProducerStats: begin", "node", args.NodeID, "from height", args.FromHeight, "to height", args.ToHeight, "from time", args.FromTime, "to time", args.ToTime, "interval", args.Interval)
+	producers, err := s.producerStats(args.FromHeight, args.ToHeight, args.FromTime, args.ToTime)
+	if err != nil {
+		return err
+	}
+	if args.NodeID != "" {
+		stats, ok := producers[args.NodeID]
+		producers = map[string]ProducerStats{}
+		if ok {
+			producers[args.NodeID] = stats
+		}
+	}
+	reply.Producers = producers
+
+	if args.Interval == "" {
+		return nil
+	}
+	if args.FromHeight != nil || args.ToHeight != nil {
+		return errors.New("interval requires a time range rather than a height range")
+	}
+	from, to := int64(0), int64(math.MaxInt64)
+	if args.FromTime != nil {
+		from = *args.FromTime
+	}
+	if args.ToTime != nil {
+		to = *args.ToTime
+	}
+	buckets, err := s.vm.state.GetProducerBuckets(args.Interval, from, to)
+	if err != nil {
+		return err
+	}
+	if args.NodeID != "" {
+		filtered := []ProducerBucket{}
+		for _, bucket := range buckets {
+			if stats, ok := bucket.Producers[args.NodeID]; ok {
+				bucket.Producers = map[string]ProducerStats{args.NodeID: stats}
+				filtered = append(filtered, bucket)
+			}
+		}
+		buckets = filtered
+	}
+	reply.Buckets = buckets
+	return nil
+}
+
+// producerStats reads per node statistics over a height range or a time
+// range from the producer index. No range means the whole chain.
+func (s *Service) producerStats(fromHeight, toHeight *uint64, fromTime, toTime *int64) (map[string]ProducerStats, error) {
+	byHeight := fromHeight != nil || toHeight != nil
+	byTime := fromTime != nil || toTime != nil
+	if byHeight && byTime {
+		return nil, errors.New("specify either a height range or a time range, not both")
+	}
+
+	if byTime {
+		from, to := int64(0), int64(math.MaxInt64)
+		if fromTime != nil {
+			from = *fromTime
+		}
+		if toTime != nil {
+			to = *toTime
+		}
+		return s.vm.state.GetProducerStatsInTimeRange(from, to)
+	}
+
+	from, to := uint64(0), uint64(math.MaxUint64)
+	if fromHeight != nil {
+		from = *fromHeight
+	}
+	if toHeight != nil {
+		to = *toHeight
+	}
+	producers, err := s.vm.state.GetProducers()
+	if err != nil {
+		return nil, fmt.Errorf("error listing producers: %w", err)
+	}
+	stats := make(map[string]ProducerStats, len(producers))
+	for _, producer := range producers {
+		producerStats, err := s.vm.state.GetProducerStats(producer, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("error getting statistics of %s: %w", producer, err)
+		}
+		if producerStats.Count > 0 {
+			stats[producer] = producerStats
+		}
+	}
+	return stats, nil
+}
+
 // GetBlock gets the block whose ID is [args.ID]
 // If [args.ID] is empty, get the latest block
 func (s *Service) GetBlock(_ *http.Request, args *GetBlockArgs, reply *GetBlockReply) error {
 	// If an ID is given, parse its string representation to an ids.ID
 	// If no ID is given, ID becomes the ID of last accepted block
-	log.Debug("GetBlock: begin", "id", args.ID, "height", args.Height)
+	log.Debug("GetBlock: begin", "id", args.ID, "height", args.Height, "encoding", args.Encoding)
 	var (
 		id  ids.ID
 		err error
@@ -199,12 +457,426 @@ func (s *Service) GetBlock(_ *http.Request, args *GetBlockArgs, reply *GetBlockR
 		return fmt.Errorf("Error retrieving block %e", err)
 	}
 
-	// Fill out the response with the block's data
+	return fillBlockReply(block, args.Encoding, reply)
+}
+
+// fillBlockReply fills out [reply] with [block]'s data, encoded in [encoding].
+// The metadata is always filled out: if the zcash block can't be loaded or
+// hashed, the fields derived from it are left empty and Error says why.
+func fillBlockReply(block *Block, encoding string, reply *GetBlockReply) error {
+	if err := checkEncoding(encoding); err != nil {
+		return err
+	}
 	reply.ID = block.ID()
 	reply.Timestamp = json.Uint64(block.Timestamp().Unix())
 	reply.ParentID = block.Parent()
+	reply.Height = json.Uint64(block.Height())
+	reply.Status = block.Status().String()
 	reply.ProducingNode = block.ProducingNode
-	reply.Data = string(block.Bytes())
+	reply.Pruned = block.Pruned()
+	reply.Encoding = encoding
+	if reply.Encoding == "" {
+		reply.Encoding = EncodingHex
+	}
+	// pruned blocks keep their zcash hash, so it's set even if zcashd no
+	// longer serves the zcash block
+	if zhash, err := block.ZcashHash(); err != nil {
+		reply.Error = fmt.Sprintf("error hashing zcash block: %s", err)
+	} else {
+		reply.ZcashHash = zhash
+	}
+	if err := block.loadPayload(); err != nil {
+		reply.Error = fmt.Sprintf("error loading pruned zcash block: %s", err)
+		return nil
+	}
+	data, err := encodeBlock(block, encoding)
+	if err != nil {
+		return err
+	}
+	reply.Data = data
+	reply.Size = json.Uint64(len(block.Bytes()))
+	reply.ZBlock = hex.EncodeToString(block.ZBlock())
+	return nil
+}
 
-	return err
+// GetBlocksArgs are the arguments to GetBlocks
+type GetBlocksArgs struct {
+	FromHeight uint64  `json:"fromHeight"`         // inclusive
+	ToHeight   *uint64 `json:"toHeight,omitempty"` // exclusive. Defaults to past the last accepted block
+	Limit      int     `json:"limit"`
+	Cursor     string  `json:"cursor"` // cursor from the previous page, if any. Takes the place of FromHeight
+	Encoding   string  `json:"encoding"`
+}
+
+// GetBlocksReply is the reply from GetBlocks
+type GetBlocksReply struct {
+	Blocks []GetBlockReply `json:"blocks"`
+	Cursor string          `json:"cursor,omitempty"` // fetches the next page. Empty on the last page
+}
+
+// GetBlocks gets the accepted blocks with heights in [args.FromHeight,
+// args.ToHeight), a page of at most [args.Limit] blocks at a time
+func (s *Service) GetBlocks(_ *http.Request, args *GetBlocksArgs, reply *GetBlocksReply) error {
+	log.Debug("GetBlocks: begin", "from height", args.FromHeight, "to height", args.ToHeight, "limit", args.Limit, "cursor", args.Cursor)
+	if err := checkEncoding(args.Encoding); err != nil {
+		return err
+	}
+	from := args.FromHeight
+	if args.Cursor != "" {
+		cursor, err := parseBlocksCursor(args.Cursor)
+		if err != nil {
+			return err
+		}
+		from = cursor
+	}
+	lastAccepted, err := s.vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	to := lastAccepted.Height() + 1
+	if args.ToHeight != nil && *args.ToHeight < to {
+		to = *args.ToHeight
+	}
+	limit := args.Limit
+	if limit <= 0 || limit > maxBlocksPerRequest {
+		limit = maxBlocksPerRequest
+	}
+
+	reply.Blocks = []GetBlockReply{}
+	height := from
+	for ; height < to && len(reply.Blocks) < limit; height++ {
+		block, err := s.vm.GetBlockAtHeight(height)
+		if err != nil {
+			return fmt.Errorf("error retrieving block at height %d: %w", height, err)
+		}
+		var blockReply GetBlockReply
+		if err := fillBlockReply(block, args.Encoding, &blockReply); err != nil {
+			return err
+		}
+		reply.Blocks = append(reply.Blocks, blockReply)
+	}
+	if height < to {
+		reply.Cursor = blocksCursor(height)
+	}
+	return nil
+}
+
+// GetBlockByZcashHashArgs are the arguments to GetBlockByZcashHash
+type GetBlockByZcashHashArgs struct {
+	Hash     string `json:"hash"` // hash of the zcash block, as zcashd displays it
+	Encoding string `json:"encoding"`
+}
+
+// GetBlockByZcashHash gets the accepted block containing the zcash block
+// whose hash is [args.Hash]
+func (s *Service) GetBlockByZcashHash(_ *http.Request, args *GetBlockByZcashHashArgs, reply *GetBlockReply) error {
+	log.Debug("GetBlockByZcashHash: begin", "hash", args.Hash)
+	blkID, err := s.vm.state.GetBlockIDByZcashHash(args.Hash)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("no accepted block contains zcash block %s", args.Hash)
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up zcash block %s: %w", args.Hash, err)
+	}
+	block, err := s.vm.getBlock(blkID)
+	if err != nil {
+		return fmt.Errorf("error retrieving block %s: %w", blkID, err)
+	}
+	return fillBlockReply(block, args.Encoding, reply)
+}
+
+// GetTxLocationArgs are the arguments to GetTxLocation
+type GetTxLocationArgs struct {
+	TxID string `json:"txID"`
+}
+
+// GetTxLocation gets the height and ID of the accepted block that includes
+// zcash transaction [args.TxID]
+func (s *Service) GetTxLocation(_ *http.Request, args *GetTxLocationArgs, reply *TxLocation) error {
+	log.Debug("GetTxLocation: begin", "txID", args.TxID)
+	loc, err := s.vm.state.GetTxLocation(args.TxID)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("no accepted block includes transaction %s", args.TxID)
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up transaction %s: %w", args.TxID, err)
+	}
+	*reply = loc
+	return nil
+}
+
+// GetBlockAtTimeArgs are the arguments to GetBlockAtTime
+type GetBlockAtTimeArgs struct {
+	Time     int64  `json:"time"` // unix seconds
+	Encoding string `json:"encoding"`
+}
+
+// GetBlockAtTime gets the last accepted block created at or before [args.Time]
+func (s *Service) GetBlockAtTime(_ *http.Request, args *GetBlockAtTimeArgs, reply *GetBlockReply) error {
+	log.Debug("GetBlockAtTime: begin", "time", args.Time)
+	timed, err := s.vm.state.GetBlockAtTime(args.Time)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("no accepted block was created at or before %d", args.Time)
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up block at time %d: %w", args.Time, err)
+	}
+	block, err := s.vm.getBlock(timed.ID)
+	if err != nil {
+		return fmt.Errorf("error retrieving block %s: %w", timed.ID, err)
+	}
+	return fillBlockReply(block, args.Encoding, reply)
+}
+
+// GetBlocksInTimeRangeArgs are the arguments to GetBlocksInTimeRange
+type GetBlocksInTimeRangeArgs struct {
+	FromTime int64  `json:"fromTime"` // unix seconds, inclusive
+	ToTime   int64  `json:"toTime"`   // unix seconds, exclusive
+	Cursor   string `json:"cursor"`   // cursor from the previous page, if any
+	Limit    int    `json:"limit"`
+}
+
+// GetBlocksInTimeRangeReply is the reply from GetBlocksInTimeRange
+type GetBlocksInTimeRangeReply struct {
+	Blocks []TimedBlock `json:"blocks"`
+	Cursor string       `json:"cursor,omitempty"` // fetches the next page. Empty on the last page
+}
+
+// GetBlocksInTimeRange lists accepted blocks created in a time range,
+// ordered by creation time then height
+func (s *Service) GetBlocksInTimeRange(_ *http.Request, args *GetBlocksInTimeRangeArgs, reply *GetBlocksInTimeRangeReply) error {
+	log.Debug("GetBlocksInTimeRange: begin", "from time", args.FromTime, "to time", args.ToTime, "cursor", args.Cursor, "limit", args.Limit)
+	var cursor []byte
+	if args.Cursor != "" {
+		var err error
+		if cursor, err = hex.DecodeString(args.Cursor); err != nil {
+			return fmt.Errorf("invalid cursor %q", args.Cursor)
+		}
+	}
+	limit := args.Limit
+	if limit <= 0 || limit > maxTimedBlocksPerRequest {
+		limit = maxTimedBlocksPerRequest
+	}
+	blks, next, err := s.vm.state.GetBlocksInTimeRange(args.FromTime, args.ToTime, cursor, limit)
+	if err != nil {
+		return fmt.Errorf("error listing blocks in time range: %w", err)
+	}
+	reply.Blocks = blks
+	if next != nil {
+		reply.Cursor = hex.EncodeToString(next)
+	}
+	return nil
+}
+
+// GetUpgradesReply is the reply from GetUpgrades
+type GetUpgradesReply struct {
+	LastAcceptedHeight uint64    `json:"lastAcceptedHeight"`
+	LastAcceptedTime   int64     `json:"lastAcceptedTime"`
+	Active             []Upgrade `json:"active"`      // active at the last accepted block
+	Pending            []Upgrade `json:"pending"`     // scheduled but not yet active
+	Unscheduled        []string  `json:"unscheduled"` // known to this binary but missing from upgradeData
+}
+
+// GetUpgrades lists the network upgrades scheduled in upgradeData, split by
+// whether they are active at the last accepted block, and the known upgrades
+// that aren't scheduled
+func (s *Service) GetUpgrades(_ *http.Request, args *EmptyArgs, reply *GetUpgradesReply) error {
+	log.Debug("GetUpgrades: begin")
+	lastAccepted, err := s.vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return fmt.Errorf("error fetching last accepted block: %w", err)
+	}
+	reply.LastAcceptedHeight = lastAccepted.Height()
+	reply.LastAcceptedTime = lastAccepted.CreationTime
+	reply.Active = []Upgrade{}
+	reply.Pending = []Upgrade{}
+	for _, upgrade := range s.vm.upgrades.Upgrades() {
+		if upgrade.activeAt(lastAccepted.Height(), lastAccepted.CreationTime) {
+			reply.Active = append(reply.Active, upgrade)
+		} else {
+			reply.Pending = append(reply.Pending, upgrade)
+		}
+	}
+	reply.Unscheduled = s.vm.upgrades.Unscheduled()
+	return nil
+}
+
+// GetConfig returns the chain config this node runs with, defaults included,
+// with secrets redacted
+func (s *Service) GetConfig(_ *http.Request, args *EmptyArgs, reply *ChainConfig) error {
+	log.Debug("GetConfig: begin")
+	*reply = s.vm.config.Redacted()
+	return nil
+}
+
+// GetEnvironmentReply is the reply from GetEnvironment
+type GetEnvironmentReply struct {
+	NetworkID    uint32 `json:"networkID"`
+	Environment  string `json:"environment"`
+	DebugAPIs    bool   `json:"debugAPIs"` // whether submitTx, mineBlock, zcashrpc and associateZcashHostPort are served
+	ZcashNetwork string `json:"zcashNetwork"`
+}
+
+// GetEnvironment reports the environment this node works out from its
+// avalanche network and chain config, and the zcash network zcashd runs
+func (s *Service) GetEnvironment(_ *http.Request, args *EmptyArgs, reply *GetEnvironmentReply) error {
+	log.Debug("GetEnvironment: begin")
+	reply.NetworkID = s.vm.ctx.NetworkID
+	reply.Environment = s.vm.environment
+	reply.DebugAPIs = s.vm.environment == EnvironmentTest
+	reply.ZcashNetwork = s.vm.zcashNetwork
+	return nil
+}
+
+// ListAllowedZcashMethodsReply is the reply from ListAllowedZcashMethods
+type ListAllowedZcashMethodsReply struct {
+	Allowed []string                       `json:"allowed"`
+	Denied  []string                       `json:"denied"`
+	Params  map[string][]ZcashRPCParamRule `json:"params"` // rules for the parameters of allowed methods that have them
+}
+
+// ListAllowedZcashMethods reports which zcashd methods zcashrpc forwards and
+// which it never does
+func (s *Service) ListAllowedZcashMethods(_ *http.Request, args *EmptyArgs, reply *ListAllowedZcashMethodsReply) error {
+	log.Debug("ListAllowedZcashMethods: begin")
+	reply.Allowed, reply.Params = s.vm.zcashRPCPolicy.Allowed()
+	reply.Denied = s.vm.zcashRPCPolicy.Denied()
+	return nil
+}
+
+// AddWebhook starts delivering events to a webhook and stores it, so it's
+// delivered to after restarts
+func (s *Service) AddWebhook(_ *http.Request, args *Webhook, reply *WebhookInfo) error {
+	log.Debug("AddWebhook: begin", "id", args.ID, "url", args.URL, "events", args.Events)
+	if !s.vm.config.AdminAPIEnabled {
+		return errAdminAPIDisabled
+	}
+	if problems := webhookProblems(*args, "webhook"); len(problems) > 0 {
+		return fmt.Errorf("invalid webhook: %s", strings.Join(problems, "; "))
+	}
+	if s.vm.webhooks.has(args.ID) {
+		return fmt.Errorf("a webhook with id %q already exists", args.ID)
+	}
+	hook := *args
+	hook.Source = WebhookSourceAdmin
+	if err := s.vm.state.PutWebhook(hook); err != nil {
+		return fmt.Errorf("error storing webhook: %w", err)
+	}
+	if err := s.vm.state.Commit(); err != nil {
+		return fmt.Errorf("error storing webhook: %w", err)
+	}
+	s.vm.webhooks.add(hook)
+	log.Info("Webhook added by admin", "id", hook.ID, "url", hook.URL, "events", hook.Events)
+	hook.Secret = redacted
+	reply.Webhook = hook
+	return nil
+}
+
+// RemoveWebhookArgs are the arguments to RemoveWebhook
+type RemoveWebhookArgs struct {
+	ID string `json:"id"`
+}
+
+// RemoveWebhook stops delivering to a webhook added through AddWebhook.
+// Its pending deliveries are dropped; its dead letters are kept.
+func (s *Service) RemoveWebhook(_ *http.Request, args *RemoveWebhookArgs, reply *SuccessReply) error {
+	log.Debug("RemoveWebhook: begin", "id", args.ID)
+	if !s.vm.config.AdminAPIEnabled {
+		return errAdminAPIDisabled
+	}
+	infos, _ := s.vm.webhooks.list()
+	source := ""
+	for _, info := range infos {
+		if info.ID == args.ID {
+			source = info.Source
+		}
+	}
+	switch source {
+	case "":
+		return fmt.Errorf("no webhook has id %q", args.ID)
+	case WebhookSourceConfig:
+		return fmt.Errorf("webhook %q is set in the chain config and can only be removed there", args.ID)
+	}
+	if err := s.vm.state.DeleteWebhook(args.ID); err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if err := s.vm.state.Commit(); err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	s.vm.webhooks.remove(args.ID)
+	log.Info("Webhook removed by admin", "id", args.ID)
+	reply.Success = true
+	return nil
+}
+
+// ListWebhooksReply is the reply from ListWebhooks
+type ListWebhooksReply struct {
+	Webhooks []WebhookInfo `json:"webhooks"`
+	// events dropped since startup because the webhook queue was full
+	Dropped uint64 `json:"dropped"`
+}
+
+// ListWebhooks lists the webhooks, secrets redacted, with their delivery
+// statistics since startup
+func (s *Service) ListWebhooks(_ *http.Request, args *EmptyArgs, reply *ListWebhooksReply) error {
+	log.Debug("ListWebhooks: begin")
+	reply.Webhooks, reply.Dropped = s.vm.webhooks.list()
+	sort.Slice(reply.Webhooks, func(i, j int) bool { return reply.Webhooks[i].ID < reply.Webhooks[j].ID })
+	return nil
+}
+
+// GetWebhookDeadLettersArgs are the arguments to GetWebhookDeadLetters
+type GetWebhookDeadLettersArgs struct {
+	WebhookID string `json:"webhookID"` // only list this webhook's dead letters
+	Cursor    string `json:"cursor"`    // cursor from the previous page, if any
+	Limit     int    `json:"limit"`
+}
+
+// GetWebhookDeadLettersReply is the reply from GetWebhookDeadLetters
+type GetWebhookDeadLettersReply struct {
+	DeadLetters []DeadLetter `json:"deadLetters"`
+	Cursor      string       `json:"cursor,omitempty"` // fetches the next page. Empty on the last page
+}
+
+// GetWebhookDeadLetters lists the webhook deliveries that failed every
+// attempt, oldest first
+func (s *Service) GetWebhookDeadLetters(_ *http.Request, args *GetWebhookDeadLettersArgs, reply *GetWebhookDeadLettersReply) error {
+	log.Debug("GetWebhookDeadLetters: begin", "webhookID", args.WebhookID, "cursor", args.Cursor, "limit", args.Limit)
+	var from uint64
+	if args.Cursor != "" {
+		cursor, err := hex.DecodeString(args.Cursor)
+		if err != nil {
+			return fmt.Errorf("invalid cursor %q", args.Cursor)
+		}
+		if from, err = database.ParseUInt64(cursor); err != nil {
+			return fmt.Errorf("invalid cursor %q", args.Cursor)
+		}
+	}
+	limit := args.Limit
+	if limit <= 0 || limit > maxDeadLettersPerRequest {
+		limit = maxDeadLettersPerRequest
+	}
+
+	reply.DeadLetters = []DeadLetter{}
+	for len(reply.DeadLetters) < limit {
+		letters, err := s.vm.state.GetDeadLetters(from, limit)
+		if err != nil {
+			return fmt.Errorf("error reading dead letters: %w", err)
+		}
+		for _, letter := range letters {
+			from = letter.Seq + 1
+			if args.WebhookID != "" && letter.WebhookID != args.WebhookID {
+				continue
+			}
+			reply.DeadLetters = append(reply.DeadLetters, letter)
+			if len(reply.DeadLetters) == limit {
+				break
+			}
+		}
+		if len(letters) < limit {
+			return nil
+		}
+	}
+	reply.Cursor = hex.EncodeToString(database.PackUInt64(from))
+	return nil
 }
@@ -0,0 +1,474 @@
+package zapavm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	snapshotFormatVersion = 1
+
+	snapshotManifestFile  = "manifest.json"
+	snapshotBlockFile     = "block.kv"
+	snapshotHeightFile    = "height.kv"
+	snapshotSingletonFile = "singleton.kv"
+
+	// longest key or value a snapshot record may hold
+	maxSnapshotRecordSize = 64 * 1024 * 1024
+)
+
+var (
+	// data files in the order they're written to and restored from an archive
+	snapshotFiles = []string{snapshotBlockFile, snapshotHeightFile, snapshotSingletonFile}
+
+	snapshotLastAcceptedKey = []byte("lastAccepted")
+	snapshotInitializedKey  = []byte("initialized")
+)
+
+// SnapshotManifest describes a snapshot archive. It's the archive's first
+// entry, followed by the files it lists.
+type SnapshotManifest struct {
+	FormatVersion  int       `json:"formatVersion"`
+	ChainID        ids.ID    `json:"chainID"`
+	Height         uint64    `json:"height"`
+	LastAcceptedID ids.ID    `json:"lastAcceptedID"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// file name --> hex sha256 of its contents
+	Files map[string]string `json:"files"`
+}
+
+// WriteSnapshot writes the accepted chain up to [height] to a gzipped tar
+// archive at [path]. The archive holds the blocks, the height index and the
+// singleton state the chain would have had with the block at [height] last
+// accepted, each as a file of length-prefixed key/value records.
+func (vm *VM) WriteSnapshot(path string, height uint64) (SnapshotManifest, error) {
+	manifest := SnapshotManifest{
+		FormatVersion: snapshotFormatVersion,
+		ChainID:       vm.ctx.ChainID,
+		Height:        height,
+		CreatedAt:     time.Now().UTC(),
+		Files:         make(map[string]string),
+	}
+	lastAccepted, err := vm.state.GetLastAcceptedBlock()
+	if err != nil {
+		return manifest, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	if height > lastAccepted.Height() {
+		return manifest, fmt.Errorf("height %d is above the last accepted block at height %d", height, lastAccepted.Height())
+	}
+	if manifest.LastAcceptedID, err = vm.state.GetBlockIDAtHeight(height); err != nil {
+		return manifest, fmt.Errorf("error getting block at height %d: %w", height, err)
+	}
+
+	// the manifest leads the archive, so the data files are staged first to
+	// hash them
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".zapavm-snapshot-")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, write func(w io.Writer) error) error {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if err := write(io.MultiWriter(f, h)); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+		manifest.Files[name] = hex.EncodeToString(h.Sum(nil))
+		return f.Close()
+	}
+	if err := writeFile(snapshotBlockFile, func(w io.Writer) error {
+		for h := uint64(0); h <= height; h++ {
+			blk, err := vm.GetBlockAtHeight(h)
+			if err != nil {
+				return err
+			}
+			bytes, err := blk.LoadBytes()
+			if err != nil {
+				return fmt.Errorf("error loading block at height %d: %w", h, err)
+			}
+			blkID := blk.ID()
+			if err := writeSnapshotRecord(w, blkID[:], bytes); err != nil {
+				return err
+			}
+			if h%importCommitInterval == 0 {
+				log.Info("Snapshot progress", "height", h)
+			}
+		}
+		return nil
+	}); err != nil {
+		return manifest, err
+	}
+	if err := writeFile(snapshotHeightFile, func(w io.Writer) error {
+		for h := uint64(0); h <= height; h++ {
+			blkID, err := vm.state.GetBlockIDAtHeight(h)
+			if err != nil {
+				return err
+			}
+			if err := writeSnapshotRecord(w, database.PackUInt64(h), blkID[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return manifest, err
+	}
+	if err := writeFile(snapshotSingletonFile, func(w io.Writer) error {
+		if err := writeSnapshotRecord(w, snapshotLastAcceptedKey, manifest.LastAcceptedID[:]); err != nil {
+			return err
+		}
+		return writeSnapshotRecord(w, snapshotInitializedKey, nil)
+	}); err != nil {
+		return manifest, err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := writeSnapshotArchive(tmpPath, dir, manifest); err != nil {
+		os.Remove(tmpPath)
+		return manifest, err
+	}
+	return manifest, os.Rename(tmpPath, path)
+}
+
+// writeSnapshotArchive writes [manifest] and the data files staged in [dir]
+// to a gzipped tar archive at [path]
+func writeSnapshotArchive(path string, dir string, manifest SnapshotManifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    snapshotManifestFile,
+		Mode:    0o644,
+		Size:    int64(len(manifestBytes)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifestBytes); err != nil {
+		return err
+	}
+
+	for _, name := range snapshotFiles {
+		if err := addSnapshotFile(tw, filepath.Join(dir, name), name, manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func addSnapshotFile(tw *tar.Writer, path string, name string, modTime time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    info.Size(),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writeSnapshotRecord writes a key/value record, each prefixed by its length
+func writeSnapshotRecord(w io.Writer, key []byte, value []byte) error {
+	p := wrappers.Packer{Bytes: make([]byte, 2*wrappers.IntLen+len(key)+len(value))}
+	p.PackBytes(key)
+	p.PackBytes(value)
+	_, err := w.Write(p.Bytes)
+	return err
+}
+
+// readSnapshotRecord reads a record written by writeSnapshotRecord. It
+// returns io.EOF at the end of [r].
+func readSnapshotRecord(r io.Reader) ([]byte, []byte, error) {
+	key, err := readSnapshotField(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := readSnapshotField(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return key, value, err
+}
+
+func readSnapshotField(r io.Reader) ([]byte, error) {
+	lenBytes := make([]byte, wrappers.IntLen)
+	if _, err := io.ReadFull(r, lenBytes); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(lenBytes)
+	if size > maxSnapshotRecordSize {
+		return nil, fmt.Errorf("snapshot record of %d bytes is too large", size)
+	}
+	field := make([]byte, size)
+	if _, err := io.ReadFull(r, field); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return field, nil
+}
+
+// restoreSnapshot loads the snapshot archive at [path] into the chain's
+// empty database. The snapshot's last accepted block must be [trustedID].
+// As every block hashes to its ID and links to its parent, that one ID
+// vouches for the whole chain. A database that is already initialized is
+// left alone, so the snapshot may stay configured after the first start.
+func (vm *VM) restoreSnapshot(path string, trustedID ids.ID) (err error) {
+	initialized, err := vm.state.IsInitialized()
+	if err != nil {
+		return err
+	}
+	if initialized {
+		log.Info("Database is already initialized, not restoring snapshot", "path", path)
+		return nil
+	}
+	if trustedID == ids.Empty {
+		return errors.New("restoring a snapshot requires restoreSnapshotBlockID, the trusted ID of its last accepted block")
+	}
+	log.Info("Restoring snapshot", "path", path, "trusted block", trustedID)
+
+	// don't leave a partial chain behind for the next start to build on
+	defer func() {
+		if err == nil {
+			return
+		}
+		if clearErr := vm.state.ClearState(); clearErr != nil {
+			log.Error("Error clearing partially restored snapshot", "error", clearErr)
+			return
+		}
+		if commitErr := vm.state.Commit(); commitErr != nil {
+			log.Error("Error clearing partially restored snapshot", "error", commitErr)
+		}
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("snapshot is not a gzipped archive: %w", err)
+	}
+	tr := tar.NewReader(gr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("error reading snapshot manifest: %w", err)
+	}
+	if header.Name != snapshotManifestFile {
+		return fmt.Errorf("snapshot starts with %s rather than %s", header.Name, snapshotManifestFile)
+	}
+	manifest := SnapshotManifest{}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("error decoding snapshot manifest: %w", err)
+	}
+	switch {
+	case manifest.FormatVersion != snapshotFormatVersion:
+		return fmt.Errorf("snapshot format version %d isn't supported, expected %d", manifest.FormatVersion, snapshotFormatVersion)
+	case manifest.ChainID != vm.ctx.ChainID:
+		return fmt.Errorf("snapshot is of chain %s rather than %s", manifest.ChainID, vm.ctx.ChainID)
+	case manifest.LastAcceptedID != trustedID:
+		return fmt.Errorf("snapshot's last accepted block is %s rather than the trusted %s", manifest.LastAcceptedID, trustedID)
+	}
+
+	restore := map[string]func(r io.Reader) error{
+		snapshotBlockFile:     func(r io.Reader) error { return vm.restoreSnapshotBlocks(r, manifest) },
+		snapshotHeightFile:    func(r io.Reader) error { return vm.checkSnapshotHeights(r, manifest) },
+		snapshotSingletonFile: func(r io.Reader) error { return vm.restoreSnapshotSingletons(r, manifest) },
+	}
+	for _, name := range snapshotFiles {
+		header, err := tr.Next()
+		if err != nil {
+			return fmt.Errorf("error reading %s from snapshot: %w", name, err)
+		}
+		if header.Name != name {
+			return fmt.Errorf("snapshot has %s where %s was expected", header.Name, name)
+		}
+		h := sha256.New()
+		if err := restore[name](io.TeeReader(tr, h)); err != nil {
+			return fmt.Errorf("error restoring %s: %w", name, err)
+		}
+		if err := checkSnapshotHash(name, h, manifest); err != nil {
+			return err
+		}
+	}
+
+	// imported chains rebuild their indexes with the backfill migrations
+	if err := vm.state.SetSchemaVersion(0); err != nil {
+		return err
+	}
+	if err := vm.state.Commit(); err != nil {
+		return err
+	}
+	log.Info("Restored snapshot", "height", manifest.Height, "last accepted", manifest.LastAcceptedID)
+	return nil
+}
+
+func checkSnapshotHash(name string, h hash.Hash, manifest SnapshotManifest) error {
+	if got := hex.EncodeToString(h.Sum(nil)); got != manifest.Files[name] {
+		return fmt.Errorf("%s hashes to %s rather than %s listed in the manifest", name, got, manifest.Files[name])
+	}
+	return nil
+}
+
+// restoreSnapshotBlocks stores the blocks in [r], which must form the chain
+// from genesis to the manifest's last accepted block
+func (vm *VM) restoreSnapshotBlocks(r io.Reader, manifest SnapshotManifest) error {
+	var prev *Block
+	for {
+		key, value, err := readSnapshotRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		blk, err := parseBlock(value, choices.Accepted, vm)
+		if err != nil {
+			return fmt.Errorf("error parsing block %x: %w", key, err)
+		}
+		blkID := blk.ID()
+		switch {
+		case string(key) != string(blkID[:]):
+			return fmt.Errorf("block stored under %x hashes to %s", key, blkID)
+		case prev == nil && blk.Height() != 0:
+			return fmt.Errorf("snapshot starts at height %d rather than genesis", blk.Height())
+		case prev != nil && (blk.Height() != prev.Height()+1 || blk.Parent() != prev.ID()):
+			return fmt.Errorf("block %s at height %d doesn't follow block %s at height %d", blkID, blk.Height(), prev.ID(), prev.Height())
+		}
+		if err := vm.state.PutBlock(blk); err != nil {
+			return err
+		}
+		prev = blk
+		if blk.Height()%importCommitInterval == 0 {
+			log.Info("Snapshot restore progress", "height", blk.Height())
+			if err := vm.state.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if prev == nil || prev.ID() != manifest.LastAcceptedID || prev.Height() != manifest.Height {
+		return fmt.Errorf("snapshot's blocks don't end at block %s at height %d", manifest.LastAcceptedID, manifest.Height)
+	}
+	return nil
+}
+
+// checkSnapshotHeights checks the height index in [r] against the restored
+// blocks, which already rebuilt it
+func (vm *VM) checkSnapshotHeights(r io.Reader, manifest SnapshotManifest) error {
+	count := uint64(0)
+	for {
+		key, value, err := readSnapshotRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		height, err := database.ParseUInt64(key)
+		if err != nil {
+			return err
+		}
+		blkID, err := vm.state.GetBlockIDAtHeight(height)
+		if err != nil {
+			return fmt.Errorf("no block restored at height %d: %w", height, err)
+		}
+		if string(value) != string(blkID[:]) {
+			return fmt.Errorf("height %d is indexed to %x rather than the restored block %s", height, value, blkID)
+		}
+		count++
+	}
+	if count != manifest.Height+1 {
+		return fmt.Errorf("snapshot indexes %d heights rather than %d", count, manifest.Height+1)
+	}
+	return nil
+}
+
+// restoreSnapshotSingletons restores the last accepted block and marks the
+// database initialized
+func (vm *VM) restoreSnapshotSingletons(r io.Reader, manifest SnapshotManifest) error {
+	restoredLastAccepted, restoredInitialized := false, false
+	for {
+		key, value, err := readSnapshotRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch string(key) {
+		case string(snapshotLastAcceptedKey):
+			lastAccepted, err := ids.ToID(value)
+			if err != nil {
+				return err
+			}
+			if lastAccepted != manifest.LastAcceptedID {
+				return fmt.Errorf("last accepted block is %s rather than %s", lastAccepted, manifest.LastAcceptedID)
+			}
+			if err := vm.state.SetLastAccepted(lastAccepted); err != nil {
+				return err
+			}
+			restoredLastAccepted = true
+		case string(snapshotInitializedKey):
+			if err := vm.state.SetInitialized(); err != nil {
+				return err
+			}
+			restoredInitialized = true
+		default:
+			return fmt.Errorf("unknown singleton %q", key)
+		}
+	}
+	if !restoredLastAccepted || !restoredInitialized {
+		return errors.New("snapshot is missing the last accepted block or initialized marker")
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ava-labs/avalanchego/database"
 	"github.com/ava-labs/avalanchego/database/prefixdb"
 	"github.com/ava-labs/avalanchego/database/versiondb"
+	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/snow/choices"
 	"github.com/ava-labs/avalanchego/vms/components/avax"
 	pstate "github.com/ava-labs/avalanchego/vms/proposervm/state"
@@ -22,6 +23,17 @@ var (
 	singletonStatePrefix = []byte("singleton")
 	blockStatePrefix     = []byte("block")
 	heightIndexPrefix    = []byte("height")
+	rejectedIndexPrefix  = []byte("rejected")
+	zblockIndexPrefix    = []byte("zblock")
+	txIndexPrefix        = []byte("tx")
+	unindexedPrefix      = []byte("unindexed")
+	producerIndexPrefix  = []byte("producer")
+	timeIndexPrefix      = []byte("time")
+	webhookPrefix        = []byte("webhook")
+	rolledBackPrefix     = []byte("rolledback")
+
+	// key in the singleton database holding the schema version of the database layout
+	schemaVersionKey = []byte("schemaVersion")
 
 	_ State = &state{}
 )
@@ -34,6 +46,24 @@ type State interface {
 	avax.SingletonState
 	BlockState
 	pstate.HeightIndex
+	RejectedIndex
+	ZcashIndex
+	ProducerIndex
+	TimeIndex
+	WebhookStore
+
+	CollectRejectedBlocks(below uint64, limit int) (int, error)
+
+	// GetSchemaVersion returns the schema version of the database layout.
+	// Databases written before versioning are at version 0.
+	GetSchemaVersion() (uint64, error)
+	SetSchemaVersion(version uint64) error
+
+	// zcash blocks a rollback invalidated, by hash. They are reconsidered
+	// once consensus accepts them again.
+	PutRolledBackZcash(hash string) error
+	HasRolledBackZcash(hash string) (bool, error)
+	DeleteRolledBackZcash(hash string) error
 
 	Commit() error
 	Close() error
@@ -44,8 +74,15 @@ type state struct {
 	avax.SingletonState
 	BlockState
 	pstate.HeightIndex
-
-	baseDB *versiondb.Database
+	RejectedIndex
+	ZcashIndex
+	ProducerIndex
+	TimeIndex
+	WebhookStore
+
+	singletonDB  database.Database
+	rolledBackDB database.Database
+	baseDB       *versiondb.Database
 }
 
 func (s *state) PutBlock(blk *Block) error {
@@ -54,8 +91,11 @@ func (s *state) PutBlock(blk *Block) error {
 	if pberr != nil {
 		return fmt.Errorf("Error calling BlockState.PutBlock: %e", pberr)
 	}
-	if blk.Status() == choices.Accepted {
+	switch blk.Status() {
+	case choices.Accepted:
 		return s.HeightIndex.SetBlockIDAtHeight(blk.Hght, blk.id)
+	case choices.Rejected:
+		return s.RejectedIndex.PutRejectedBlock(blk)
 	}
 	return nil
 }
@@ -89,24 +129,33 @@ func DeleteDb(db database.Database) error {
 }
 
 
+// chainDB returns the part of [db] that holds chain [chainID]'s [prefix]
+// data, named <chainID>-<prefix>
+func chainDB(db database.Database, chainID ids.ID, prefix []byte) database.Database {
+	return prefixdb.New([]byte(chainID.String()+"-"+string(prefix)), db)
+}
+
 func NewState(db database.Database, vm *VM) State {
 	log.Debug("NewState: begin")
 
 	// create a new baseDB
 	baseDB := versiondb.New(db)
 
-	chainPrefix := vm.ctx.ChainID.String()
+	chainID := vm.ctx.ChainID
 
 	// create a prefixed "blockDB" from baseDB
-	blockDBPref := chainPrefix + "-" + string(blockStatePrefix)
-	singletonDBPref := chainPrefix + "-" + string(singletonStatePrefix)
-	heightDBPref := chainPrefix + "-" + string(heightIndexPrefix)
-
-
-	blockDB := prefixdb.New([]byte(blockDBPref), baseDB)
-	singletonDB := prefixdb.New([]byte(singletonDBPref), baseDB)
-
-	heightDB := prefixdb.New([]byte(heightDBPref), baseDB)
+	blockDB := chainDB(baseDB, chainID, blockStatePrefix)
+	singletonDB := chainDB(baseDB, chainID, singletonStatePrefix)
+
+	heightDB := chainDB(baseDB, chainID, heightIndexPrefix)
+	rejectedDB := chainDB(baseDB, chainID, rejectedIndexPrefix)
+	zblockDB := chainDB(baseDB, chainID, zblockIndexPrefix)
+	txDB := chainDB(baseDB, chainID, txIndexPrefix)
+	unindexedDB := chainDB(baseDB, chainID, unindexedPrefix)
+	producerDB := chainDB(baseDB, chainID, producerIndexPrefix)
+	timeDB := chainDB(baseDB, chainID, timeIndexPrefix)
+	webhookDB := chainDB(baseDB, chainID, webhookPrefix)
+	rolledBackDB := chainDB(baseDB, chainID, rolledBackPrefix)
 
 	// return state with created sub state components
 	log.Debug("NewState: returning")
@@ -114,10 +163,41 @@ func NewState(db database.Database, vm *VM) State {
 		BlockState:     NewBlockState(blockDB, vm),
 		SingletonState: avax.NewSingletonState(singletonDB),
 		HeightIndex:    pstate.NewHeightIndex(heightDB, baseDB),
+		RejectedIndex:  NewRejectedIndex(rejectedDB),
+		ZcashIndex:     NewZcashIndex(zblockDB, txDB, unindexedDB),
+		ProducerIndex:  NewProducerIndex(producerDB),
+		TimeIndex:      NewTimeIndex(timeDB),
+		WebhookStore:   NewWebhookStore(webhookDB),
+		singletonDB:    singletonDB,
+		rolledBackDB:   rolledBackDB,
 		baseDB:         baseDB,
 	}
 }
 
+func (s *state) GetSchemaVersion() (uint64, error) {
+	version, err := database.GetUInt64(s.singletonDB, schemaVersionKey)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (s *state) SetSchemaVersion(version uint64) error {
+	return database.PutUInt64(s.singletonDB, schemaVersionKey, version)
+}
+
+func (s *state) PutRolledBackZcash(hash string) error {
+	return s.rolledBackDB.Put([]byte(hash), nil)
+}
+
+func (s *state) HasRolledBackZcash(hash string) (bool, error) {
+	return s.rolledBackDB.Has([]byte(hash))
+}
+
+func (s *state) DeleteRolledBackZcash(hash string) error {
+	return s.rolledBackDB.Delete([]byte(hash))
+}
+
 // Commit commits pending operations to baseDB
 func (s *state) Commit() error {
 	return s.baseDB.Commit()
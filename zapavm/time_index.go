@@ -0,0 +1,163 @@
+package zapavm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+// width of the first window searched back from a time for the block at it.
+// Each empty window doubles it.
+const timeSearchWindow = 60 * 60
+
+var _ TimeIndex = &timeIndex{}
+
+// TimeIndex orders accepted blocks by creation time, then height
+type TimeIndex interface {
+	PutBlockTime(blk *Block) error
+	DeleteBlockTime(blk *Block) error
+
+	// GetBlockAtTime returns the accepted block with the latest creation
+	// time at or before [timestamp], the highest one if several share it
+	GetBlockAtTime(timestamp int64) (TimedBlock, error)
+	// GetBlocksInTimeRange returns up to [limit] accepted blocks created in
+	// [from, to), ordered by creation time then height, starting at
+	// [cursor] if it's set. The returned cursor resumes after the last
+	// returned block, and is nil once the range is exhausted.
+	GetBlocksInTimeRange(from int64, to int64, cursor []byte, limit int) ([]TimedBlock, []byte, error)
+}
+
+// TimedBlock is an accepted block in the time index
+type TimedBlock struct {
+	CreationTime int64  `json:"creationTime"`
+	Height       uint64 `json:"height"`
+	ID           ids.ID `json:"id"`
+}
+
+type timeIndex struct {
+	db database.Database
+}
+
+// NewTimeIndex returns a TimeIndex stored in [db]
+func NewTimeIndex(db database.Database) TimeIndex {
+	return &timeIndex{db: db}
+}
+
+// timeKey orders entries by creation time, then height
+func timeKey(timestamp int64, height uint64) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, 2*wrappers.LongLen)}
+	p.PackLong(uint64(clampTime(timestamp)))
+	p.PackLong(height)
+	return p.Bytes
+}
+
+// clampTime keeps block times before 1970, which sort after every other
+// time as unsigned keys, at the start of the index
+func clampTime(timestamp int64) int64 {
+	if timestamp < 0 {
+		return 0
+	}
+	return timestamp
+}
+
+func parseTimeEntry(key []byte, value []byte) (TimedBlock, error) {
+	p := wrappers.Packer{Bytes: key}
+	timestamp := int64(p.UnpackLong())
+	height := p.UnpackLong()
+	if p.Errored() {
+		return TimedBlock{}, fmt.Errorf("corrupt time index key %x: %w", key, p.Err)
+	}
+	blkID, err := ids.ToID(value)
+	if err != nil {
+		return TimedBlock{}, err
+	}
+	return TimedBlock{CreationTime: timestamp, Height: height, ID: blkID}, nil
+}
+
+func (t *timeIndex) PutBlockTime(blk *Block) error {
+	blkID := blk.ID()
+	return t.db.Put(timeKey(blk.CreationTime, blk.Height()), blkID[:])
+}
+
+func (t *timeIndex) DeleteBlockTime(blk *Block) error {
+	return t.db.Delete(timeKey(blk.CreationTime, blk.Height()))
+}
+
+func (t *timeIndex) GetBlockAtTime(timestamp int64) (TimedBlock, error) {
+	timestamp = clampTime(timestamp)
+	end := timeKey(timestamp+1, 0)
+	if timestamp == math.MaxInt64 {
+		end = nil
+	}
+	// iterators only go forward, so search windows ending at [timestamp],
+	// doubling them until one has a block in it
+	for window := int64(timeSearchWindow); ; window *= 2 {
+		start := timestamp - window
+		if start < 0 || window <= 0 {
+			start = 0
+		}
+		found, blk, err := t.lastBefore(timeKey(start, 0), end)
+		if err != nil || found {
+			return blk, err
+		}
+		if start == 0 {
+			return TimedBlock{}, database.ErrNotFound
+		}
+		end = timeKey(start, 0)
+	}
+}
+
+// lastBefore returns the last entry in [start, end). A nil [end] is unbounded.
+func (t *timeIndex) lastBefore(start []byte, end []byte) (bool, TimedBlock, error) {
+	it := t.db.NewIteratorWithStart(start)
+	defer it.Release()
+
+	var lastKey, lastValue []byte
+	for it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			break
+		}
+		lastKey = append(lastKey[:0], it.Key()...)
+		lastValue = append(lastValue[:0], it.Value()...)
+	}
+	if err := it.Error(); err != nil {
+		return false, TimedBlock{}, err
+	}
+	if lastKey == nil {
+		return false, TimedBlock{}, nil
+	}
+	blk, err := parseTimeEntry(lastKey, lastValue)
+	return err == nil, blk, err
+}
+
+func (t *timeIndex) GetBlocksInTimeRange(from int64, to int64, cursor []byte, limit int) ([]TimedBlock, []byte, error) {
+	start := timeKey(from, 0)
+	if cursor != nil {
+		if len(cursor) != 2*wrappers.LongLen {
+			return nil, nil, fmt.Errorf("invalid cursor %x", cursor)
+		}
+		start = cursor
+	}
+	it := t.db.NewIteratorWithStart(start)
+	defer it.Release()
+
+	blks := []TimedBlock{}
+	for it.Next() {
+		blk, err := parseTimeEntry(it.Key(), it.Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		if blk.CreationTime >= to {
+			break
+		}
+		if len(blks) == limit {
+			return blks, timeKey(blk.CreationTime, blk.Height), it.Error()
+		}
+		blks = append(blks, blk)
+	}
+	return blks, nil, it.Error()
+}
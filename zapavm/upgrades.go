@@ -0,0 +1,147 @@
+package zapavm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UpgradeRawZcashBlocks switches blocks from legacyCodecVersion, whose ZBlk
+// is zcashd's JSON-wrapped hex, to CodecVersion, whose ZBlk is the raw zcash
+// block. Blocks below it must use the legacy format and blocks at or above
+// it the raw one.
+const UpgradeRawZcashBlocks = "rawZcashBlocks"
+
+// knownUpgrades are the upgrades this binary implements. Consensus changes
+// are gated on a name added here, checked with Block.IsUpgradeActive or
+// VM.IsUpgradeActive, and scheduled by validators through upgradeData.
+var knownUpgrades = map[string]bool{
+	UpgradeRawZcashBlocks: true,
+}
+
+var errUnknownUpgrade = errors.New("upgrade isn't implemented by this version of zapavm")
+
+// Upgrade is a network upgrade and when it activates. Exactly one of Height
+// and Timestamp is set.
+type Upgrade struct {
+	Name string `json:"name"`
+	// Height is the first block height the upgrade is active at
+	Height *uint64 `json:"height,omitempty"`
+	// Timestamp is the first block creation time the upgrade is active at,
+	// in unix seconds
+	Timestamp *int64 `json:"timestamp,omitempty"`
+}
+
+// activeAt returns whether the upgrade is active for a block at [height]
+// created at [timestamp]
+func (u Upgrade) activeAt(height uint64, timestamp int64) bool {
+	if u.Height != nil {
+		return height >= *u.Height
+	}
+	return timestamp >= *u.Timestamp
+}
+
+// activation describes when the upgrade activates, for logging
+func (u Upgrade) activation() string {
+	if u.Height != nil {
+		return fmt.Sprintf("height %d", *u.Height)
+	}
+	return fmt.Sprintf("timestamp %d", *u.Timestamp)
+}
+
+// UpgradeSchedule maps upgrade names to when they activate. Upgrades that
+// aren't scheduled are never active.
+type UpgradeSchedule struct {
+	upgrades map[string]Upgrade
+}
+
+// ParseUpgradeSchedule parses [upgradeData], a JSON object mapping upgrade
+// names to {"height": n} or {"timestamp": n}. Empty data is an empty
+// schedule.
+func ParseUpgradeSchedule(upgradeData []byte) (UpgradeSchedule, error) {
+	schedule := UpgradeSchedule{upgrades: make(map[string]Upgrade)}
+	if len(bytes.TrimSpace(upgradeData)) == 0 {
+		return schedule, nil
+	}
+
+	var activations map[string]json.RawMessage
+	if err := json.Unmarshal(upgradeData, &activations); err != nil {
+		return schedule, fmt.Errorf("error parsing upgradeData: %w", err)
+	}
+	for name, raw := range activations {
+		if !knownUpgrades[name] {
+			return schedule, fmt.Errorf("%w: %q is scheduled in upgradeData", errUnknownUpgrade, name)
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		activation := struct {
+			Height    *uint64 `json:"height"`
+			Timestamp *int64  `json:"timestamp"`
+		}{}
+		if err := dec.Decode(&activation); err != nil {
+			return schedule, fmt.Errorf("error parsing activation of upgrade %q: %w", name, err)
+		}
+		if (activation.Height == nil) == (activation.Timestamp == nil) {
+			return schedule, fmt.Errorf("upgrade %q needs exactly one of height and timestamp", name)
+		}
+		schedule.upgrades[name] = Upgrade{
+			Name:      name,
+			Height:    activation.Height,
+			Timestamp: activation.Timestamp,
+		}
+	}
+	return schedule, nil
+}
+
+// IsActive returns whether upgrade [name] is active for a block at [height]
+// created at [timestamp]
+func (s UpgradeSchedule) IsActive(name string, height uint64, timestamp int64) bool {
+	upgrade, ok := s.upgrades[name]
+	return ok && upgrade.activeAt(height, timestamp)
+}
+
+// Upgrades returns the scheduled upgrades, ordered by name
+func (s UpgradeSchedule) Upgrades() []Upgrade {
+	upgrades := make([]Upgrade, 0, len(s.upgrades))
+	for _, upgrade := range s.upgrades {
+		upgrades = append(upgrades, upgrade)
+	}
+	sort.Slice(upgrades, func(i, j int) bool { return upgrades[i].Name < upgrades[j].Name })
+	return upgrades
+}
+
+// Unscheduled returns the known upgrades missing from the schedule, sorted.
+// They never activate until validators add them to upgradeData.
+func (s UpgradeSchedule) Unscheduled() []string {
+	names := []string{}
+	for name := range knownUpgrades {
+		if _, ok := s.upgrades[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsUpgradeActive returns whether upgrade [name] is active for a block at
+// [height] created at [timestamp]. Blocks being built ask this before they
+// are encoded.
+func (vm *VM) IsUpgradeActive(name string, height uint64, timestamp int64) bool {
+	return vm.upgrades.IsActive(name, height, timestamp)
+}
+
+// IsUpgradeActive returns whether upgrade [name] is active at this block
+func (b *Block) IsUpgradeActive(name string) bool {
+	return b.vm.IsUpgradeActive(name, b.Height(), b.CreationTime)
+}
+
+// blockCodecVersion returns the codec version blocks at [height] created at
+// [timestamp] are encoded with
+func (vm *VM) blockCodecVersion(height uint64, timestamp int64) uint16 {
+	if vm.IsUpgradeActive(UpgradeRawZcashBlocks, height, timestamp) {
+		return CodecVersion
+	}
+	return legacyCodecVersion
+}
@@ -0,0 +1,89 @@
+package zapavm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlockCodecVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		upgradeData string
+		height      uint64
+		timestamp   int64
+		want        uint16
+	}{
+		{"unscheduled", "", 100, 1000, legacyCodecVersion},
+		{"before height", `{"rawZcashBlocks":{"height":10}}`, 9, 1000, legacyCodecVersion},
+		{"at height", `{"rawZcashBlocks":{"height":10}}`, 10, 0, CodecVersion},
+		{"after height", `{"rawZcashBlocks":{"height":10}}`, 11, 0, CodecVersion},
+		{"before timestamp", `{"rawZcashBlocks":{"timestamp":500}}`, 100, 499, legacyCodecVersion},
+		{"at timestamp", `{"rawZcashBlocks":{"timestamp":500}}`, 0, 500, CodecVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			upgrades, err := ParseUpgradeSchedule([]byte(test.upgradeData))
+			if err != nil {
+				t.Fatal(err)
+			}
+			vm := &VM{upgrades: upgrades}
+			if got := vm.blockCodecVersion(test.height, test.timestamp); got != test.want {
+				t.Fatalf("blockCodecVersion(%d, %d) = %d, expected %d", test.height, test.timestamp, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckCodecVersion(t *testing.T) {
+	upgrades, err := ParseUpgradeSchedule([]byte(`{"rawZcashBlocks":{"height":10}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := &VM{upgrades: upgrades}
+
+	tests := []struct {
+		name         string
+		height       uint64
+		codecVersion uint16
+		wantErr      error
+	}{
+		{"legacy before upgrade", 9, legacyCodecVersion, nil},
+		{"raw before upgrade", 9, CodecVersion, errWrongCodecVersion},
+		{"raw at upgrade", 10, CodecVersion, nil},
+		{"legacy at upgrade", 10, legacyCodecVersion, errWrongCodecVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blk := &Block{Hght: test.height, codecVersion: test.codecVersion, vm: vm}
+			if err := blk.checkCodecVersion(); !errors.Is(err, test.wantErr) {
+				t.Fatalf("checkCodecVersion() = %v, expected %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseUpgradeSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		upgradeData string
+		wantErr     bool
+	}{
+		{"empty", "", false},
+		{"whitespace", " \n", false},
+		{"height", `{"rawZcashBlocks":{"height":1}}`, false},
+		{"timestamp", `{"rawZcashBlocks":{"timestamp":1}}`, false},
+		{"unknown upgrade", `{"nope":{"height":1}}`, true},
+		{"both", `{"rawZcashBlocks":{"height":1,"timestamp":1}}`, true},
+		{"neither", `{"rawZcashBlocks":{}}`, true},
+		{"unknown field", `{"rawZcashBlocks":{"hieght":1}}`, true},
+		{"not json", `rawZcashBlocks`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseUpgradeSchedule([]byte(test.upgradeData))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseUpgradeSchedule() = %v, expected error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
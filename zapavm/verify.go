@@ -0,0 +1,199 @@
+package zapavm
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/database/versiondb"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+	pstate "github.com/ava-labs/avalanchego/vms/proposervm/state"
+)
+
+// ChainAnomaly is one problem found by VerifyChainDatabase
+type ChainAnomaly struct {
+	Height  *uint64 `json:"height,omitempty"` // height index entry the problem was found at, if any
+	BlockID ids.ID  `json:"blockID"`
+	Problem string  `json:"problem"`
+}
+
+// ChainReport is the result of VerifyChainDatabase
+type ChainReport struct {
+	ChainID            ids.ID         `json:"chainID"`
+	LastAcceptedID     ids.ID         `json:"lastAcceptedID"`
+	LastAcceptedHeight uint64         `json:"lastAcceptedHeight"`
+	HeightsChecked     uint64         `json:"heightsChecked"`
+	StoredBlocks       uint64         `json:"storedBlocks"`
+	AcceptedBlocks     uint64         `json:"acceptedBlocks"`
+	RejectedBlocks     uint64         `json:"rejectedBlocks"`
+	PrunedBlocks       uint64         `json:"prunedBlocks"` // pruned blocks' hashes can't be checked offline
+	Anomalies          []ChainAnomaly `json:"anomalies"`
+}
+
+func (r *ChainReport) addf(height *uint64, blkID ids.ID, format string, args ...interface{}) {
+	r.Anomalies = append(r.Anomalies, ChainAnomaly{
+		Height:  height,
+		BlockID: blkID,
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+// VerifyChainDatabase checks chain [chainID]'s block and height index data
+// in [db] without writing to it. It walks the height index from genesis to
+// the last accepted block and checks, for every height, that the stored
+// block hashes to its ID, has that height, links to the block below it and
+// is accepted. It then scans every stored block for statuses that disagree
+// with the height index. Every problem found is reported; the returned error
+// is only for failures to read the database.
+func VerifyChainDatabase(db database.Database, chainID ids.ID) (ChainReport, error) {
+	report := ChainReport{ChainID: chainID}
+
+	baseDB := versiondb.New(db)
+	blockDB := chainDB(baseDB, chainID, blockStatePrefix)
+	heightIndex := pstate.NewHeightIndex(chainDB(baseDB, chainID, heightIndexPrefix), baseDB)
+
+	lastAccepted, err := database.GetID(blockDB, lastAcceptedKey)
+	if err != nil {
+		return report, fmt.Errorf("error getting last accepted block: %w", err)
+	}
+	report.LastAcceptedID = lastAccepted
+
+	getBlock := func(blkID ids.ID) (*Block, error) {
+		wrappedBytes, err := blockDB.Get(blkID[:])
+		if err != nil {
+			return nil, err
+		}
+		return decodeStoredBlock(blkID, wrappedBytes, nil)
+	}
+
+	tip, err := getBlock(lastAccepted)
+	if err != nil {
+		return report, fmt.Errorf("error reading last accepted block %s: %w", lastAccepted, err)
+	}
+	report.LastAcceptedHeight = tip.Height()
+
+	var (
+		prevID       = ids.Empty
+		missingStart *uint64 // first height of the current run of missing entries
+	)
+	reportMissing := func(end uint64) {
+		if missingStart == nil {
+			return
+		}
+		start := *missingStart
+		if start == end-1 {
+			report.addf(&start, ids.Empty, "height index has no entry")
+		} else {
+			report.addf(&start, ids.Empty, "height index has no entries for heights %d to %d", start, end-1)
+		}
+		missingStart = nil
+	}
+	for height := uint64(0); height <= tip.Height(); height++ {
+		h := height
+		report.HeightsChecked++
+		blkID, err := heightIndex.GetBlockIDAtHeight(h)
+		if err == database.ErrNotFound {
+			if missingStart == nil {
+				missingStart = &h
+			}
+			// the next block's parent can't be checked against a missing entry
+			prevID = ids.Empty
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("error reading height index at %d: %w", h, err)
+		}
+		reportMissing(h)
+
+		expectedParent := prevID
+		prevID = blkID
+
+		blk, err := getBlock(blkID)
+		if err == database.ErrNotFound {
+			report.addf(&h, blkID, "indexed block is not stored")
+			continue
+		}
+		if err != nil {
+			report.addf(&h, blkID, "stored block can't be decoded: %v", err)
+			continue
+		}
+		if blk.pruned {
+			report.PrunedBlocks++
+		} else if blk.ID() != blkID {
+			report.addf(&h, blkID, "stored bytes hash to %s", blk.ID())
+		}
+		if blk.Height() != h {
+			report.addf(&h, blkID, "block has height %d", blk.Height())
+		}
+		if h == 0 {
+			if blk.Parent() != ids.Empty {
+				report.addf(&h, blkID, "genesis block has parent %s", blk.Parent())
+			}
+		} else if expectedParent != ids.Empty && blk.Parent() != expectedParent {
+			report.addf(&h, blkID, "block has parent %s rather than %s, the block indexed at height %d", blk.Parent(), expectedParent, h-1)
+		}
+		if blk.Status() != choices.Accepted {
+			report.addf(&h, blkID, "indexed block has status %s", blk.Status())
+		}
+	}
+	reportMissing(tip.Height() + 1)
+	if prevID != ids.Empty && prevID != lastAccepted {
+		h := tip.Height()
+		report.addf(&h, prevID, "height index ends at %s rather than the last accepted block %s", prevID, lastAccepted)
+	}
+
+	// entries above the last accepted block are left over from an
+	// interrupted accept or rollback
+	for height := tip.Height() + 1; ; height++ {
+		h := height
+		blkID, err := heightIndex.GetBlockIDAtHeight(h)
+		if err == database.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("error reading height index at %d: %w", h, err)
+		}
+		report.addf(&h, blkID, "height index has an entry above the last accepted block")
+	}
+
+	it := blockDB.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		// skip singleton keys such as lastAcceptedKey
+		if len(it.Key()) != len(ids.Empty) {
+			continue
+		}
+		blkID, err := ids.ToID(it.Key())
+		if err != nil {
+			return report, err
+		}
+		report.StoredBlocks++
+		blk, err := decodeStoredBlock(blkID, it.Value(), nil)
+		if err != nil {
+			report.addf(nil, blkID, "stored block can't be decoded: %v", err)
+			continue
+		}
+		switch blk.Status() {
+		case choices.Accepted:
+			report.AcceptedBlocks++
+			h := blk.Height()
+			indexedID, err := heightIndex.GetBlockIDAtHeight(h)
+			switch {
+			case err == database.ErrNotFound:
+				report.addf(&h, blkID, "accepted block is not in the height index")
+			case err != nil:
+				return report, fmt.Errorf("error reading height index at %d: %w", h, err)
+			case indexedID != blkID:
+				report.addf(&h, blkID, "accepted block conflicts with %s in the height index", indexedID)
+			}
+		case choices.Rejected:
+			report.RejectedBlocks++
+		default:
+			report.addf(nil, blkID, "stored block has status %s", blk.Status())
+		}
+	}
+	if err := it.Error(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
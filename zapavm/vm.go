@@ -12,8 +12,6 @@ import (
 	log "github.com/inconshreveable/log15"
 	"github.com/zapalabs/zapavm/zapavm/zclient"
 
-	nativejson "encoding/json"
-
 	"github.com/ava-labs/avalanchego/database/manager"
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/snow"
@@ -35,18 +33,6 @@ const (
 var (
 	Version            = version.NewDefaultVersion(1, 2, 0)
 	_ block.ChainVM = &VM{}
-
-	// Whether or not we're on fuji. Controls whether or not certain
-	// debug features were enabled (e.g. faucet, mining empty blocks)
-	TestNet = true
-
-	// If a chain is here, it's disabled. If the disabled flag is present
-	// in the chain config, the chain will also be disabled. A chain cannot
-	// be removed from this list via config.
-	DisabledChains = map[string]bool{
-		"HydwMTPrYBWHrGVmWfG8k4Po2eTPEqe7y7Z4jZaUr2Me6rin7": true,
-		"2LedqoeDb3zZQSqPBczemzrofepr6SzSHXxHXANrfzeFKGGNVd": true,
-	}
 )
 
 var originalStderr *os.File
@@ -87,10 +73,47 @@ type VM struct {
 
 	zc zclient.ZcashClient
 
-	enabled bool
+	// chain config this VM was initialized with
+	config ChainConfig
+
+	// genesis parsed from genesisData, nil for chains created with the
+	// placeholder genesis
+	genesis *Genesis
+
+	// network upgrades parsed from upgradeData
+	upgrades UpgradeSchedule
+
+	// whether this chain builds blocks, which the admin API can change
+	enablement chainEnablement
+
+	// EnvironmentProduction or EnvironmentTest, which serves debug endpoints
+	environment string
+
+	// zcash network zcashd runs: main, test or regtest
+	zcashNetwork string
+
+	// zcashd methods zcashrpc forwards
+	zcashRPCPolicy *ZcashRPCPolicy
 
 	// Indicates that this VM has finised bootstrapping for the chain
 	bootstrapped utils.AtomicBool
+
+	// whether the consensus engine initialized this VM, as opposed to an
+	// offline tool
+	online bool
+
+	// closed when this VM shuts down, to stop background work
+	shutdownChan chan struct{}
+
+	// what the rejected block collector has done since startup
+	gcStats RejectedGCStats
+	gcMetrics *rejectedGCMetrics
+
+	// notifies event stream subscribers of blocks and transactions
+	events *eventBus
+
+	// delivers events to webhooks, nil until the initial sync is done
+	webhooks *webhookDispatcher
 }
 
 // Initialize this vm
@@ -109,6 +132,7 @@ func (vm *VM) Initialize(
 	_ []*common.Fx,
 	as common.AppSender,
 ) error {
+	vm.online = true
 	version, err := vm.Version()
 	if err != nil {
 		log.Error("error initializing Zapa VM: %v", err)
@@ -119,7 +143,13 @@ func (vm *VM) Initialize(
 	vm.toEngine = toEngine
 	vm.verifiedBlocks = make(map[ids.ID]*Block)
 	vm.as = as
-	conf := NewChainConfig(configData)
+	vm.shutdownChan = make(chan struct{})
+	vm.events = newEventBus()
+	conf, err := NewChainConfig(configData)
+	if err != nil {
+		return err
+	}
+	vm.config = conf
 
 	logLevel, err := log.LvlFromString(conf.LogLevel)
 	if err != nil {
@@ -127,18 +157,52 @@ func (vm *VM) Initialize(
 	}
 	vm.setLogLevel(logLevel)
 
-	log.Info("Initializing zapa VM", "Version", version, "nodeid", ctx.NodeID, "config", conf)
+	log.Info("Initializing zapa VM", "Version", version, "nodeid", ctx.NodeID, "config", conf.Redacted())
 
-	vm.enabled = vm.isEnabled(conf)
+	enablement, err := configuredEnablement(conf, vm.ctx.ChainID.String())
+	if err != nil {
+		return err
+	}
+	vm.enablement.set(enablement)
+	if !enablement.Enabled {
+		log.Warn("Chain is disabled: it won't build blocks and reports unhealthy", "chain", vm.ctx.ChainID, "source", enablement.Source, "reason", enablement.Reason)
+	}
+	if conf.MaintenanceMode {
+		log.Warn("Chain is in maintenance mode: it won't build or verify blocks", "chain", vm.ctx.ChainID)
+	}
+
+	if vm.genesis, err = ParseGenesis(genesisData); err != nil {
+		return err
+	}
+	if vm.genesis == nil {
+		log.Warn("genesisData has no genesis, the chain's genesis is ingested from zcashd")
+	}
 
-	if !vm.enabled {
-		return fmt.Errorf("Chain %s is not enabled", vm.ctx.ChainID)
+	if vm.upgrades, err = ParseUpgradeSchedule(upgradeData); err != nil {
+		return err
+	}
+	for _, upgrade := range vm.upgrades.Upgrades() {
+		log.Info("Scheduled network upgrade", "name", upgrade.Name, "activation", upgrade.activation())
+	}
+	if unscheduled := vm.upgrades.Unscheduled(); len(unscheduled) > 0 {
+		log.Info("Network upgrades not scheduled in upgradeData", "upgrades", unscheduled)
 	}
 
 	vm.zc, err = conf.ZcashClient(vm.ctx.NodeID.String())
 
 	if err != nil {
-		return fmt.Errorf("Error initializing zcash client: %e", err)
+		return fmt.Errorf("Error initializing zcash client: %w", err)
+	}
+
+	if vm.environment, err = environmentFor(ctx.NetworkID, conf.Environment); err != nil {
+		return err
+	}
+	if vm.zcashNetwork, err = vm.zc.GetNetwork(); err != nil {
+		return fmt.Errorf("error getting zcashd's network: %w", err)
+	}
+	log.Info("Running environment", "networkID", ctx.NetworkID, "environment", vm.environment, "zcash network", vm.zcashNetwork)
+	if vm.zcashRPCPolicy, err = NewZcashRPCPolicy(conf.ZcashRPC); err != nil {
+		return err
 	}
 
 	// Create new state
@@ -153,13 +217,37 @@ func (vm *VM) Initialize(
 	} else {
 		log.Debug("Not clearing database before initializing, picking up where we left off...")
 	}
+
+	if conf.RestoreSnapshot != "" {
+		if err := vm.restoreSnapshot(conf.RestoreSnapshot, conf.RestoreSnapshotBlockID); err != nil {
+			return fmt.Errorf("error restoring snapshot %s: %w", conf.RestoreSnapshot, err)
+		}
+	}
+
+	if err := vm.migrate(conf.MigrationDryRun); err != nil {
+		return err
+	}
 	res := vm.initAndSync()
 	if res != nil {
 		log.Error("Error during initialization", "error", res)
-	} else {
-		log.Info("Successfully completed initialization of zapavm")
+		return res
 	}
-	return res
+	if err := vm.reindexZcashBlocks(); err != nil {
+		return fmt.Errorf("error indexing deferred zcash blocks: %w", err)
+	}
+	log.Info("Successfully completed initialization of zapavm")
+
+	if err := vm.initWebhooks(); err != nil {
+		return err
+	}
+
+	if conf.RejectedGCDepth > 0 {
+		if vm.gcMetrics, err = newRejectedGCMetrics(vm.ctx.Metrics); err != nil {
+			return fmt.Errorf("error registering rejected block collector metrics: %w", err)
+		}
+		go vm.runRejectedBlockCollector()
+	}
+	return nil
 }
 
 // SetState sets this VM state according to given snow.State
@@ -245,13 +333,24 @@ func (vm *VM) CreateHandlers() (map[string]*common.HTTPHandler, error) {
 	server := rpc.NewServer()
 	server.RegisterCodec(json.NewCodec(), "application/json")
 	server.RegisterCodec(json.NewCodec(), "application/json;charset=UTF-8")
-	if err := server.RegisterService(&Service{vm: vm}, Name); err != nil {
+	// debug endpoints are only served in test environments
+	var service interface{} = &Service{vm: vm}
+	if vm.environment == EnvironmentTest {
+		service = &DebugService{Service: &Service{vm: vm}}
+	}
+	if err := server.RegisterService(service, Name); err != nil {
 		return nil, err
 	}
 
 	return map[string]*common.HTTPHandler{
 		"": {
-			Handler: server,
+			Handler: newAuthHandler(server, vm.config.APITokens),
+		},
+		// event streams are long-lived, so they take the context lock
+		// themselves when they need it
+		"/events": {
+			LockOptions: common.NoLock,
+			Handler:     newAuthHandler(newEventStreamHandler(vm), vm.config.APITokens),
 		},
 	}, nil
 }
@@ -278,11 +377,20 @@ func (vm *VM) CreateStaticHandlers() (map[string]*common.HTTPHandler, error) {
 }
 
 // Health implements the common.VM interface
-func (vm *VM) HealthCheck() (interface{}, error) { return nil, nil }
+// A disabled chain reports unhealthy, with the reason.
+func (vm *VM) HealthCheck() (interface{}, error) {
+	return vm.Enablement(), vm.checkEnabled()
+}
 
 // BuildBlock returns a block that this vm wants to add to consensus
 func (vm *VM) BuildBlock() (snowman.Block, error) {
 	log.Info("vm.BuildBlock: begin. Building and proposing block for consensus")
+	if err := vm.checkEnabled(); err != nil {
+		return nil, err
+	}
+	if vm.config.MaintenanceMode {
+		return nil, errMaintenanceMode
+	}
 	suggestResult := vm.zc.SuggestBlock()
 	if suggestResult.Error != nil {
 		return nil, fmt.Errorf("Error suggesting block %e", suggestResult.Error)
@@ -311,6 +419,9 @@ func (vm *VM) BuildBlock() (snowman.Block, error) {
 // NotifyBlockReady tells the consensus engine that a new block
 // is ready to be created
 func (vm *VM) NotifyBlockReady() {
+	if !vm.Enablement().Enabled {
+		return
+	}
 	select {
 	case vm.toEngine <- common.PendingTxs:
 	default:
@@ -318,8 +429,23 @@ func (vm *VM) NotifyBlockReady() {
 	}
 }
 
-// GetBlock implements the snowman.ChainVM interface
-func (vm *VM) GetBlock(blkID ids.ID) (snowman.Block, error) { return vm.getBlock(blkID) }
+// GetBlock implements the snowman.ChainVM interface. Consensus serves the
+// bytes of the blocks it gets to peers, so the payload of a pruned block is
+// loaded from zcashd first.
+func (vm *VM) GetBlock(blkID ids.ID) (snowman.Block, error) {
+	blk, err := vm.getBlock(blkID)
+	if err != nil {
+		return nil, err
+	}
+	if err := blk.loadPayload(); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// GetBlockByID returns block [blkID] without loading the payload of a
+// pruned block
+func (vm *VM) GetBlockByID(blkID ids.ID) (*Block, error) { return vm.getBlock(blkID) }
 
 func (vm *VM) getBlock(blkID ids.ID) (*Block, error) {
 	// If block is in memory, return it.
@@ -348,21 +474,21 @@ func (vm *VM) LastAcceptedBlock() (*Block, error) {
 // from another node
 func (vm *VM) ParseBlock(bytes []byte) (snowman.Block, error) {
 	log.Debug("ParseBlock: begin")
-	// A new empty block
-	block := &Block{}
-
-	// Unmarshal the byte repr. of the block into our empty block
-	_, err := Codec.Unmarshal(bytes, block)
+	// Unmarshal the byte repr. of the block and initialize it
+	block, err := parseBlock(bytes, choices.Processing, vm)
 	if err != nil {
 		return nil, fmt.Errorf("Error unmarshalling block: %e", err)
 	}
-
-	// Initialize the block
-	block.Initialize(bytes, choices.Processing, vm)
+	if err := block.checkCodecVersion(); err != nil {
+		return nil, err
+	}
 
 	if blk, err := vm.getBlock(block.ID()); err == nil {
 		// If we have seen this block before, return it with the most up-to-date
-		// info
+		// info. A pruned copy can take its payload from [bytes] rather than zcashd.
+		if blk.pruned && blk.bytes == nil {
+			blk.setPayload(block.ZBlk, bytes)
+		}
 		log.Debug("ParseBlock: return. We have seen this block", blk.LogInfo()...)
 		return blk, nil
 	}
@@ -376,21 +502,27 @@ func (vm *VM) ParseBlock(bytes []byte) (snowman.Block, error) {
 // - the block's parent is [parentID]
 // - the block's data is [data]
 // - the block's timestamp is [timestamp]
-func (vm *VM) NewBlock(parentID ids.ID, height uint64, zblock nativejson.RawMessage, timestamp int64) (*Block, error) {
+func (vm *VM) NewBlock(parentID ids.ID, height uint64, zblock []byte, timestamp int64) (*Block, error) {
 	log.Debug("NewBlock: begin")
 	block := &Block{
 		PrntID: parentID,
 		Hght:   height,
 		ZBlk:   zblock,
 		CreationTime: timestamp,
+		codecVersion: vm.blockCodecVersion(height, timestamp),
 	}
 
 	if height > 0 {
 		block.ProducingNode = vm.ctx.NodeID.String()
 	}
 
-	// Get the byte representation of the block
-	blockBytes, err := Codec.Marshal(CodecVersion, block)
+	// Get the byte representation of the block. Legacy blocks carry zcashd's
+	// JSON-wrapped hex, but keep the raw zcash block in memory.
+	encoded := *block
+	if block.codecVersion == legacyCodecVersion {
+		encoded.ZBlk = zclient.EncodeZBlock(zblock)
+	}
+	blockBytes, err := Codec.Marshal(block.codecVersion, &encoded)
 	if err != nil {
 		return nil, fmt.Errorf("Error marshalling block bytes %e", err)
 	}
@@ -408,11 +540,24 @@ func (vm *VM) Shutdown() error {
 	if vm.state == nil {
 		return nil
 	}
+	if !vm.isShutdown() {
+		close(vm.shutdownChan)
+	}
 
 	log.Debug("Shutdown: calling vm.state.close()")
 	return vm.state.Close() // close versionDB
 }
 
+// isShutdown returns whether Shutdown has been called
+func (vm *VM) isShutdown() bool {
+	select {
+	case <-vm.shutdownChan:
+		return true
+	default:
+		return false
+	}
+}
+
 // SetPreference sets the block with ID [ID] as the preferred block
 func (vm *VM) SetPreference(id ids.ID) error {
 	log.Debug("SetPreference: begin", "id", id)
@@ -441,6 +586,7 @@ func (vm *VM) AppGossip(nodeID ids.ShortID, msg []byte) error {
 	if msg != nil {
 		log.Debug("Calling zcash.receivetx")
 		vm.zc.CallZcash("receivetx", msg)
+		vm.publishTx(TxSourceGossip, nodeID.String(), msg)
 		log.Debug("Calling vm.NotifyBlockReady()")
 		vm.NotifyBlockReady()
 	}
@@ -503,7 +649,19 @@ func (vm *VM) initAndSync() error {
 		return err
 	}	
 	
+	if vm.genesis != nil {
+		if err := vm.checkZcashGenesis(vm.genesis); err != nil {
+			return err
+		}
+	}
+
 	if stateInitialized {
+		if vm.genesis != nil {
+			if err := vm.checkGenesisBlock(vm.genesis); err != nil {
+				return err
+			}
+		}
+
 		err := vm.initializePreference()
 		if err != nil {
 			return fmt.Errorf("error initializing preference %e", err)
@@ -522,6 +680,16 @@ func (vm *VM) initAndSync() error {
 			return fmt.Errorf("Cannot initialize vm when zcash has existing blocks this VM doesn't know about")
 		} 
 
+		// pruned blocks are fetched from zcashd, so zcashd can't be synced
+		// with blocks it's missing from the pruned range
+		prunedHeight, err := vm.state.GetPrunedHeight()
+		if err != nil {
+			return err
+		}
+		if preferredHeight > zcBlkCount && uint64(zcBlkCount+1) < prunedHeight {
+			return fmt.Errorf("%w: zcashd is at height %d and blocks below height %d are pruned, reseed zcashd from an unpruned node", errZcashMissingPruned, zcBlkCount, prunedHeight)
+		}
+
 		for preferredHeight > zcBlkCount {
 			zcBlkCount += 1
 			log.Info("Syncing block with zcash", "block number", zcBlkCount)
@@ -529,10 +697,35 @@ func (vm *VM) initAndSync() error {
 			if e != nil {
 				return e
 			}
-			e = vm.zc.SubmitBlock(blk.ZBlock())
+			zblk, e := blk.LoadZBlock()
+			if e != nil {
+				return e
+			}
+			e = vm.zc.SubmitBlock(zblk)
 			if e != nil {
 				return fmt.Errorf("error while submitting block when syncing zcash %e", e)
 			}
+			// the zcash index needs zcashd to have the block
+			if e = vm.indexZcashBlockLater(blk); e != nil {
+				return e
+			}
+		}
+	} else if vm.genesis != nil {
+		if zcBlkCount > 0 {
+			return fmt.Errorf("Cannot initialize vm when zcash has existing blocks this VM doesn't know about")
+		}
+		genesisBlk, err := vm.genesis.Block(vm)
+		if err != nil {
+			return fmt.Errorf("error building genesis block: %w", err)
+		}
+		log.Info("Build genesis block from genesisData", genesisBlk.LogInfo()...)
+		if err := genesisBlk.Accept(); err != nil {
+			return fmt.Errorf("error accepting genesis block: %w", err)
+		}
+		log.Info("Accepted genesis block", genesisBlk.LogInfo()...)
+
+		if err := vm.initializePreference(); err != nil {
+			return fmt.Errorf("error initializing preference %w", err)
 		}
 	} else {
 		log.Info("Initializing zapavm by ingesting genesis from zcash")
@@ -618,13 +811,6 @@ func (vm *VM) BlockGenerator(min *int, max *int) chan Block {
 	return c
 }
 
-func (vm *VM) isEnabled(c ChainConfig) bool {
-	if _, ok := DisabledChains[vm.ctx.ChainID.String()]; ok {
-		return false
-	}
-	return c.Enabled
-}
-
 func (vm *VM) initializePreference() error {
 	// Get last accepted
 	lastAccepted, err := vm.state.GetLastAccepted()
@@ -0,0 +1,173 @@
+package zapavm
+
+import (
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+const (
+	webhookByte byte = iota
+	deadLetterByte
+	nextDeadLetterByte
+)
+
+// most dead letters kept. The oldest are deleted to make room for new ones.
+const maxDeadLetters = 10000
+
+// persists the sequence number of the next dead letter with this key
+var nextDeadLetterKey = []byte{nextDeadLetterByte}
+
+var _ WebhookStore = &webhookStore{}
+
+// WebhookStore persists the webhooks added through the admin API and the
+// deliveries that ran out of retries
+type WebhookStore interface {
+	PutWebhook(hook Webhook) error
+	DeleteWebhook(id string) error
+	GetWebhooks() ([]Webhook, error)
+
+	// PutDeadLetter records [letter] and returns its sequence number
+	PutDeadLetter(letter DeadLetter) (uint64, error)
+	// GetDeadLetters returns up to [limit] dead letters with sequence
+	// numbers from [from], oldest first
+	GetDeadLetters(from uint64, limit int) ([]DeadLetter, error)
+}
+
+// webhookEntry is the value stored for a webhook. Its ID makes up the key.
+type webhookEntry struct {
+	URL    string   `serialize:"true"`
+	Events []string `serialize:"true"`
+	Secret string   `serialize:"true"`
+}
+
+// deadLetterEntry is the value stored for a dead letter. Its sequence
+// number makes up the key.
+type deadLetterEntry struct {
+	WebhookID  string `serialize:"true"`
+	URL        string `serialize:"true"`
+	Type       string `serialize:"true"`
+	DeliveryID string `serialize:"true"`
+	Payload    []byte `serialize:"true"`
+	Attempts   uint32 `serialize:"true"`
+	LastError  string `serialize:"true"`
+	FailedAt   int64  `serialize:"true"`
+}
+
+type webhookStore struct {
+	db database.Database
+}
+
+// NewWebhookStore returns a WebhookStore stored in [db]
+func NewWebhookStore(db database.Database) WebhookStore {
+	return &webhookStore{db: db}
+}
+
+func webhookKey(id string) []byte {
+	return append([]byte{webhookByte}, id...)
+}
+
+func deadLetterKey(seq uint64) []byte {
+	p := wrappers.Packer{Bytes: make([]byte, 1+wrappers.LongLen)}
+	p.PackByte(deadLetterByte)
+	p.PackLong(seq)
+	return p.Bytes
+}
+
+func (w *webhookStore) PutWebhook(hook Webhook) error {
+	entryBytes, err := Codec.Marshal(CodecVersion, &webhookEntry{
+		URL:    hook.URL,
+		Events: hook.Events,
+		Secret: hook.Secret,
+	})
+	if err != nil {
+		return err
+	}
+	return w.db.Put(webhookKey(hook.ID), entryBytes)
+}
+
+func (w *webhookStore) DeleteWebhook(id string) error {
+	return w.db.Delete(webhookKey(id))
+}
+
+func (w *webhookStore) GetWebhooks() ([]Webhook, error) {
+	it := w.db.NewIteratorWithPrefix([]byte{webhookByte})
+	defer it.Release()
+
+	hooks := []Webhook{}
+	for it.Next() {
+		entry := webhookEntry{}
+		if _, err := Codec.Unmarshal(it.Value(), &entry); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, Webhook{
+			ID:     string(it.Key()[1:]),
+			URL:    entry.URL,
+			Events: entry.Events,
+			Secret: entry.Secret,
+			Source: WebhookSourceAdmin,
+		})
+	}
+	return hooks, it.Error()
+}
+
+func (w *webhookStore) PutDeadLetter(letter DeadLetter) (uint64, error) {
+	seq, err := database.GetUInt64(w.db, nextDeadLetterKey)
+	if err != nil && err != database.ErrNotFound {
+		return 0, err
+	}
+	entryBytes, err := Codec.Marshal(CodecVersion, &deadLetterEntry{
+		WebhookID:  letter.WebhookID,
+		URL:        letter.URL,
+		Type:       letter.Type,
+		DeliveryID: letter.DeliveryID,
+		Payload:    letter.Payload,
+		Attempts:   letter.Attempts,
+		LastError:  letter.LastError,
+		FailedAt:   letter.FailedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := w.db.Put(deadLetterKey(seq), entryBytes); err != nil {
+		return 0, err
+	}
+	// sequence numbers are never reused, so the letter maxDeadLetters
+	// before this one is the oldest kept
+	if seq >= maxDeadLetters {
+		if err := w.db.Delete(deadLetterKey(seq - maxDeadLetters)); err != nil {
+			return 0, err
+		}
+	}
+	return seq, database.PutUInt64(w.db, nextDeadLetterKey, seq+1)
+}
+
+func (w *webhookStore) GetDeadLetters(from uint64, limit int) ([]DeadLetter, error) {
+	it := w.db.NewIteratorWithStartAndPrefix(deadLetterKey(from), []byte{deadLetterByte})
+	defer it.Release()
+
+	letters := []DeadLetter{}
+	for len(letters) < limit && it.Next() {
+		p := wrappers.Packer{Bytes: it.Key()}
+		p.UnpackByte()
+		seq := p.UnpackLong()
+		if p.Errored() {
+			return nil, p.Err
+		}
+		entry := deadLetterEntry{}
+		if _, err := Codec.Unmarshal(it.Value(), &entry); err != nil {
+			return nil, err
+		}
+		letters = append(letters, DeadLetter{
+			Seq:        seq,
+			WebhookID:  entry.WebhookID,
+			URL:        entry.URL,
+			Type:       entry.Type,
+			DeliveryID: entry.DeliveryID,
+			Payload:    entry.Payload,
+			Attempts:   entry.Attempts,
+			LastError:  entry.LastError,
+			FailedAt:   entry.FailedAt,
+		})
+	}
+	return letters, it.Error()
+}
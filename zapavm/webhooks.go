@@ -0,0 +1,497 @@
+package zapavm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	log "github.com/inconshreveable/log15"
+)
+
+// EventTxConfirmed is sent to webhooks for each transaction in the zcash
+// block of an accepted block
+const EventTxConfirmed = "txConfirmed"
+
+// where a webhook was configured
+const (
+	WebhookSourceConfig = "config"
+	WebhookSourceAdmin  = "admin"
+)
+
+const (
+	// minimum length of a webhook signing secret
+	minWebhookSecretLen = 16
+	// events queued for the dispatcher before new ones are dropped
+	webhookQueueSize = 4096
+	// deliveries queued per webhook before new ones are dead-lettered
+	webhookDeliveryQueueSize = 1024
+	// attempts made at a delivery before it's dead-lettered
+	webhookMaxAttempts = 6
+	// wait before the first retry, doubled after each failed attempt
+	webhookInitialBackoff = time.Second
+	webhookMaxBackoff     = 5 * time.Minute
+	webhookTimeout        = 10 * time.Second
+	// bytes of a failed response's body kept as the error
+	webhookErrorBodyLen = 256
+)
+
+// headers of webhook requests
+const (
+	WebhookSignatureHeader = "X-Zapavm-Signature"
+	WebhookTimestampHeader = "X-Zapavm-Timestamp"
+	WebhookEventHeader     = "X-Zapavm-Event"
+	WebhookDeliveryHeader  = "X-Zapavm-Delivery"
+)
+
+// webhookEventTypes are the events webhooks can be sent
+var webhookEventTypes = map[string]bool{
+	EventBlockAccepted: true,
+	EventBlockRejected: true,
+	EventTxConfirmed:   true,
+}
+
+// Webhook is a URL that events are POSTed to
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // blockAccepted, blockRejected and txConfirmed
+	// key of the HMAC-SHA256 signature in the X-Zapavm-Signature header
+	Secret string `json:"secret"`
+	Source string `json:"source,omitempty"` // WebhookSourceConfig or WebhookSourceAdmin
+}
+
+func (w Webhook) wants(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookProblems lists what's invalid about [hook], prefixing fields with [field]
+func webhookProblems(hook Webhook, field string) []string {
+	var problems []string
+	if hook.ID == "" {
+		problems = append(problems, fmt.Sprintf("%s has no id", field))
+	}
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("%s.url %q isn't an http or https URL", field, hook.URL))
+	}
+	if len(hook.Events) == 0 {
+		problems = append(problems, fmt.Sprintf("%s has no events", field))
+	}
+	for _, e := range hook.Events {
+		if !webhookEventTypes[e] {
+			problems = append(problems, fmt.Sprintf("%s has unknown event %q, expected %q, %q or %q", field, e, EventBlockAccepted, EventBlockRejected, EventTxConfirmed))
+		}
+	}
+	if len(hook.Secret) < minWebhookSecretLen {
+		problems = append(problems, fmt.Sprintf("%s.secret is shorter than %d characters", field, minWebhookSecretLen))
+	}
+	return problems
+}
+
+// webhooksProblems lists what's invalid about the webhooks of a chain config
+func webhooksProblems(hooks []Webhook) []string {
+	var problems []string
+	seen := make(map[string]bool, len(hooks))
+	for i, hook := range hooks {
+		problems = append(problems, webhookProblems(hook, fmt.Sprintf("webhooks[%d]", i))...)
+		if seen[hook.ID] {
+			problems = append(problems, fmt.Sprintf("webhooks has more than one webhook with id %q", hook.ID))
+		}
+		seen[hook.ID] = true
+	}
+	return problems
+}
+
+// TxConfirmedEvent describes a zcash transaction included in an accepted block
+type TxConfirmedEvent struct {
+	TxID    string `json:"txID"`
+	Height  uint64 `json:"height"`
+	BlockID ids.ID `json:"blockID"`
+}
+
+// WebhookPayload is the body POSTed to a webhook
+type WebhookPayload struct {
+	// unique per delivery and unchanged across its retries, so receivers
+	// can drop duplicates
+	DeliveryID string            `json:"deliveryID"`
+	WebhookID  string            `json:"webhookID"`
+	Type       string            `json:"type"`
+	Created    int64             `json:"created"` // unix seconds
+	Block      *BlockEvent       `json:"block,omitempty"`
+	Tx         *TxConfirmedEvent `json:"tx,omitempty"`
+}
+
+// DeadLetter is a delivery that failed every attempt
+type DeadLetter struct {
+	Seq        uint64          `json:"seq"`
+	WebhookID  string          `json:"webhookID"`
+	URL        string          `json:"url"`
+	Type       string          `json:"type"`
+	DeliveryID string          `json:"deliveryID"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   uint32          `json:"attempts"`
+	LastError  string          `json:"lastError"`
+	FailedAt   int64           `json:"failedAt"` // unix seconds
+}
+
+// WebhookStats counts what happened to a webhook's deliveries since startup
+type WebhookStats struct {
+	Delivered    uint64 `json:"delivered"`
+	Retries      uint64 `json:"retries"`
+	DeadLettered uint64 `json:"deadLettered"`
+	Pending      int    `json:"pending"`
+	LastError    string `json:"lastError,omitempty"`
+}
+
+// webhookDelivery is a payload waiting to be delivered
+type webhookDelivery struct {
+	id        string
+	eventType string
+	body      []byte
+}
+
+// webhookWorker delivers one webhook's payloads in order
+type webhookWorker struct {
+	hook       Webhook
+	deliveries chan webhookDelivery
+	stop       chan struct{}
+	stats      WebhookStats // guarded by the dispatcher's lock
+}
+
+// webhookDispatcher delivers events to webhooks in the background, so
+// accepting a block never waits on a webhook
+type webhookDispatcher struct {
+	vm     *VM
+	client *http.Client
+	queue  chan Event
+
+	lock    sync.Mutex
+	workers map[string]*webhookWorker
+	// events dropped because the queue was full
+	dropped uint64
+}
+
+func newWebhookDispatcher(vm *VM) *webhookDispatcher {
+	return &webhookDispatcher{
+		vm:      vm,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan Event, webhookQueueSize),
+		workers: make(map[string]*webhookWorker),
+	}
+}
+
+// initWebhooks starts delivering to the webhooks of the chain config and
+// those added through the admin API
+func (vm *VM) initWebhooks() error {
+	vm.webhooks = newWebhookDispatcher(vm)
+	for _, hook := range vm.config.Webhooks {
+		hook.Source = WebhookSourceConfig
+		vm.webhooks.add(hook)
+	}
+	stored, err := vm.state.GetWebhooks()
+	if err != nil {
+		return fmt.Errorf("error reading webhooks: %w", err)
+	}
+	for _, hook := range stored {
+		if vm.webhooks.has(hook.ID) {
+			log.Warn("Ignoring stored webhook with the id of a configured one", "id", hook.ID)
+			continue
+		}
+		vm.webhooks.add(hook)
+	}
+	go vm.webhooks.run()
+	return nil
+}
+
+// enqueue queues [event] for delivery without blocking
+func (d *webhookDispatcher) enqueue(event Event) {
+	select {
+	case d.queue <- event:
+	default:
+		d.lock.Lock()
+		d.dropped++
+		d.lock.Unlock()
+		log.Error("Webhook queue is full, dropping event", "event", event.Type)
+	}
+}
+
+func (d *webhookDispatcher) has(id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	_, ok := d.workers[id]
+	return ok
+}
+
+// add starts delivering to [hook]
+func (d *webhookDispatcher) add(hook Webhook) {
+	worker := &webhookWorker{
+		hook:       hook,
+		deliveries: make(chan webhookDelivery, webhookDeliveryQueueSize),
+		stop:       make(chan struct{}),
+	}
+	d.lock.Lock()
+	d.workers[hook.ID] = worker
+	d.lock.Unlock()
+
+	log.Info("Delivering to webhook", "id", hook.ID, "url", hook.URL, "events", hook.Events, "source", hook.Source)
+	go d.deliverAll(worker)
+}
+
+// remove stops delivering to the webhook with [id]. Its pending deliveries
+// are dropped.
+func (d *webhookDispatcher) remove(id string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if worker, ok := d.workers[id]; ok {
+		close(worker.stop)
+		delete(d.workers, id)
+	}
+}
+
+// list returns the webhooks, secrets redacted, with their statistics
+func (d *webhookDispatcher) list() ([]WebhookInfo, uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	infos := make([]WebhookInfo, 0, len(d.workers))
+	for _, worker := range d.workers {
+		hook := worker.hook
+		hook.Secret = redacted
+		stats := worker.stats
+		stats.Pending = len(worker.deliveries)
+		infos = append(infos, WebhookInfo{Webhook: hook, Stats: stats})
+	}
+	return infos, d.dropped
+}
+
+// run hands queued events to the workers of the webhooks that want them
+// until the VM shuts down
+func (d *webhookDispatcher) run() {
+	for {
+		select {
+		case <-d.vm.shutdownChan:
+			return
+		case event := <-d.queue:
+			d.dispatch(event)
+		}
+	}
+}
+
+func (d *webhookDispatcher) dispatch(event Event) {
+	d.lock.Lock()
+	workers := make([]*webhookWorker, 0, len(d.workers))
+	wantTxs := false
+	for _, worker := range d.workers {
+		workers = append(workers, worker)
+		wantTxs = wantTxs || worker.hook.wants(EventTxConfirmed)
+	}
+	d.lock.Unlock()
+
+	for _, worker := range workers {
+		if worker.hook.wants(event.Type) {
+			d.offer(worker, WebhookPayload{Type: event.Type, Block: event.Block})
+		}
+	}
+	if event.Type != EventBlockAccepted || !wantTxs {
+		return
+	}
+	txIDs, err := d.confirmedTxIDs(event.Block)
+	if err != nil {
+		log.Warn("Error getting confirmed transactions for webhooks", "block", event.Block.ID, "error", err)
+		return
+	}
+	for _, txID := range txIDs {
+		tx := &TxConfirmedEvent{TxID: txID, Height: event.Block.Height, BlockID: event.Block.ID}
+		for _, worker := range workers {
+			if worker.hook.wants(EventTxConfirmed) {
+				d.offer(worker, WebhookPayload{Type: EventTxConfirmed, Tx: tx})
+			}
+		}
+	}
+}
+
+// confirmedTxIDs returns the transactions in the zcash block of [block]
+func (d *webhookDispatcher) confirmedTxIDs(block *BlockEvent) ([]string, error) {
+	if block.ZcashHash == "" {
+		return nil, fmt.Errorf("block has no zcash hash")
+	}
+	// zcashd is called without the context lock, so a slow zcashd doesn't
+	// stall consensus
+	d.vm.ctx.Lock.Lock()
+	zc := d.vm.zc
+	d.vm.ctx.Lock.Unlock()
+
+	return zc.GetBlockTxIDs(block.ZcashHash)
+}
+
+// offer queues [payload] for [worker], dead-lettering it if the worker's
+// queue is full
+func (d *webhookDispatcher) offer(worker *webhookWorker, payload WebhookPayload) {
+	payload.DeliveryID = newDeliveryID()
+	payload.WebhookID = worker.hook.ID
+	payload.Created = time.Now().Unix()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("Error encoding webhook payload", "webhook", worker.hook.ID, "event", payload.Type, "error", err)
+		return
+	}
+	delivery := webhookDelivery{id: payload.DeliveryID, eventType: payload.Type, body: body}
+	select {
+	case worker.deliveries <- delivery:
+	default:
+		d.deadLetter(worker, delivery, 0, "delivery queue is full")
+	}
+}
+
+// deliverAll delivers [worker]'s payloads until it's removed or the VM
+// shuts down
+func (d *webhookDispatcher) deliverAll(worker *webhookWorker) {
+	for {
+		select {
+		case <-worker.stop:
+			return
+		case <-d.vm.shutdownChan:
+			return
+		case delivery := <-worker.deliveries:
+			d.deliver(worker, delivery)
+		}
+	}
+}
+
+// deliver POSTs [delivery], retrying with exponential backoff, and
+// dead-letters it if every attempt fails
+func (d *webhookDispatcher) deliver(worker *webhookWorker, delivery webhookDelivery) {
+	backoff := webhookInitialBackoff
+	var err error
+	for attempt := uint32(1); attempt <= webhookMaxAttempts; attempt++ {
+		if err = d.post(worker.hook, delivery); err == nil {
+			d.lock.Lock()
+			worker.stats.Delivered++
+			d.lock.Unlock()
+			return
+		}
+		log.Debug("Webhook delivery failed", "webhook", worker.hook.ID, "delivery", delivery.id, "attempt", attempt, "error", err)
+		d.lock.Lock()
+		worker.stats.LastError = err.Error()
+		d.lock.Unlock()
+		if attempt == webhookMaxAttempts {
+			break
+		}
+
+		select {
+		case <-worker.stop:
+			return
+		case <-d.vm.shutdownChan:
+			return
+		case <-time.After(backoff):
+		}
+		d.lock.Lock()
+		worker.stats.Retries++
+		d.lock.Unlock()
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+	d.deadLetter(worker, delivery, webhookMaxAttempts, err.Error())
+}
+
+// post sends [delivery] to [hook] once
+func (d *webhookDispatcher) post(hook Webhook, delivery webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.eventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(hook.Secret, timestamp, delivery.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLen))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// signWebhook returns the hex HMAC-SHA256, keyed by [secret], of
+// [timestamp] and [body] joined by a dot
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter records that [delivery] to [worker]'s webhook failed
+func (d *webhookDispatcher) deadLetter(worker *webhookWorker, delivery webhookDelivery, attempts uint32, lastError string) {
+	d.lock.Lock()
+	worker.stats.DeadLettered++
+	d.lock.Unlock()
+	log.Warn("Dead-lettering webhook delivery", "webhook", worker.hook.ID, "delivery", delivery.id, "event", delivery.eventType, "attempts", attempts, "error", lastError)
+
+	d.vm.ctx.Lock.Lock()
+	defer d.vm.ctx.Lock.Unlock()
+
+	// Shutdown may have closed the database while we waited for the lock
+	if d.vm.isShutdown() {
+		return
+	}
+	letter := DeadLetter{
+		WebhookID:  worker.hook.ID,
+		URL:        worker.hook.URL,
+		Type:       delivery.eventType,
+		DeliveryID: delivery.id,
+		Payload:    delivery.body,
+		Attempts:   attempts,
+		LastError:  lastError,
+		FailedAt:   time.Now().Unix(),
+	}
+	if _, err := d.vm.state.PutDeadLetter(letter); err != nil {
+		log.Error("Error storing dead letter", "webhook", worker.hook.ID, "delivery", delivery.id, "error", err)
+		return
+	}
+	if err := d.vm.state.Commit(); err != nil {
+		log.Error("Error committing dead letter", "webhook", worker.hook.ID, "delivery", delivery.id, "error", err)
+	}
+}
+
+// newDeliveryID returns a random delivery ID
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WebhookInfo is a webhook, secret redacted, and its statistics
+type WebhookInfo struct {
+	Webhook
+	Stats WebhookStats `json:"stats"`
+}
@@ -0,0 +1,150 @@
+package zapavm
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+var _ ZcashIndex = &zcashIndex{}
+
+// ZcashIndex maps zcash block hashes and transaction IDs to the accepted
+// blocks that contain them
+type ZcashIndex interface {
+	PutZcashBlock(zhash string, blkID ids.ID) error
+	GetBlockIDByZcashHash(zhash string) (ids.ID, error)
+	DeleteZcashBlock(zhash string) error
+
+	PutTxLocation(txID string, loc TxLocation) error
+	GetTxLocation(txID string) (TxLocation, error)
+	DeleteTxLocation(txID string) error
+
+	// heights of accepted blocks that couldn't be indexed when accepted, to
+	// be indexed on the next startup
+	PutUnindexedHeight(height uint64) error
+	GetUnindexedHeights() ([]uint64, error)
+	DeleteUnindexedHeight(height uint64) error
+}
+
+// TxLocation is the accepted block a zcash transaction was included in
+type TxLocation struct {
+	Height  uint64 `json:"height"`
+	BlockID ids.ID `json:"blockID"`
+}
+
+type zcashIndex struct {
+	zblockDB    database.Database // zcash block hash --> block ID
+	txDB        database.Database // zcash txid --> height and block ID
+	unindexedDB database.Database // height --> nil
+}
+
+// NewZcashIndex returns a ZcashIndex with zcash blocks stored in [zblockDB],
+// transactions in [txDB] and heights still to index in [unindexedDB]
+func NewZcashIndex(zblockDB database.Database, txDB database.Database, unindexedDB database.Database) ZcashIndex {
+	return &zcashIndex{
+		zblockDB:    zblockDB,
+		txDB:        txDB,
+		unindexedDB: unindexedDB,
+	}
+}
+
+// zcashHashKey turns the hex hash zcashd displays into a compact key
+func zcashHashKey(hash string) ([]byte, error) {
+	key, err := hex.DecodeString(hash)
+	if err != nil || len(key) != len(ids.Empty) {
+		return nil, fmt.Errorf("%q is not a 32 byte hex hash", hash)
+	}
+	return key, nil
+}
+
+func (z *zcashIndex) PutZcashBlock(zhash string, blkID ids.ID) error {
+	key, err := zcashHashKey(zhash)
+	if err != nil {
+		return err
+	}
+	return database.PutID(z.zblockDB, key, blkID)
+}
+
+func (z *zcashIndex) GetBlockIDByZcashHash(zhash string) (ids.ID, error) {
+	key, err := zcashHashKey(zhash)
+	if err != nil {
+		return ids.Empty, err
+	}
+	return database.GetID(z.zblockDB, key)
+}
+
+func (z *zcashIndex) DeleteZcashBlock(zhash string) error {
+	key, err := zcashHashKey(zhash)
+	if err != nil {
+		return err
+	}
+	return z.zblockDB.Delete(key)
+}
+
+func (z *zcashIndex) PutTxLocation(txID string, loc TxLocation) error {
+	key, err := zcashHashKey(txID)
+	if err != nil {
+		return err
+	}
+	p := wrappers.Packer{Bytes: make([]byte, wrappers.LongLen+len(loc.BlockID))}
+	p.PackLong(loc.Height)
+	p.PackFixedBytes(loc.BlockID[:])
+	return z.txDB.Put(key, p.Bytes)
+}
+
+func (z *zcashIndex) GetTxLocation(txID string) (TxLocation, error) {
+	key, err := zcashHashKey(txID)
+	if err != nil {
+		return TxLocation{}, err
+	}
+	value, err := z.txDB.Get(key)
+	if err != nil {
+		return TxLocation{}, err
+	}
+	p := wrappers.Packer{Bytes: value}
+	height := p.UnpackLong()
+	blkIDBytes := p.UnpackFixedBytes(len(ids.Empty))
+	if p.Errored() {
+		return TxLocation{}, fmt.Errorf("corrupt location for transaction %s: %w", txID, p.Err)
+	}
+	blkID, err := ids.ToID(blkIDBytes)
+	if err != nil {
+		return TxLocation{}, err
+	}
+	return TxLocation{Height: height, BlockID: blkID}, nil
+}
+
+func (z *zcashIndex) DeleteTxLocation(txID string) error {
+	key, err := zcashHashKey(txID)
+	if err != nil {
+		return err
+	}
+	return z.txDB.Delete(key)
+}
+
+func (z *zcashIndex) PutUnindexedHeight(height uint64) error {
+	return z.unindexedDB.Put(database.PackUInt64(height), nil)
+}
+
+// GetUnindexedHeights returns the heights in ascending order
+func (z *zcashIndex) GetUnindexedHeights() ([]uint64, error) {
+	it := z.unindexedDB.NewIterator()
+	defer it.Release()
+
+	var heights []uint64
+	for it.Next() {
+		height, err := database.ParseUInt64(it.Key())
+		if err != nil {
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+	return heights, it.Error()
+}
+
+func (z *zcashIndex) DeleteUnindexedHeight(height uint64) error {
+	return z.unindexedDB.Delete(database.PackUInt64(height))
+}
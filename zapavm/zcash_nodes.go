@@ -0,0 +1,178 @@
+package zapavm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/zapalabs/zapavm/zapavm/zclient"
+)
+
+const (
+	nodeIDPrefix = "NodeID-"
+
+	// in a local ava-sim network, node i's zcashd listens on
+	// avaSimBasePort+i+1 and its NodeID is in ~/node-ids/i
+	avaSimBasePort = 8233
+	avaSimNodeIDs  = "node-ids"
+)
+
+// ZcashEndpoint is how a node reaches its zcashd. Empty fields fall back to
+// the chain config's zcashHost, zcashPort, zcashUser and zcashPassword.
+type ZcashEndpoint struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// ZcashNodes maps NodeIDs, with or without the NodeID- prefix, to the zcashd
+// each node uses
+type ZcashNodes map[string]ZcashEndpoint
+
+// problems lists what's invalid about the mapping's entries
+func (n ZcashNodes) problems(source string) []string {
+	var problems []string
+	seen := make(map[string]string, len(n))
+	for _, nodeID := range n.nodeIDs() {
+		endpoint := n[nodeID]
+		if other, ok := seen[trimNodeID(nodeID)]; ok {
+			problems = append(problems, fmt.Sprintf("%s has entries %q and %q for the same node", source, other, nodeID))
+		}
+		seen[trimNodeID(nodeID)] = nodeID
+		if endpoint.Host != "" && !validHost(endpoint.Host) {
+			problems = append(problems, fmt.Sprintf("%s entry %q: host %q isn't a hostname or IP address", source, nodeID, endpoint.Host))
+		}
+		if endpoint.Port < 0 || endpoint.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s entry %q: port %d isn't between 1 and 65535, or 0 to use zcashPort", source, nodeID, endpoint.Port))
+		}
+	}
+	return problems
+}
+
+// lookup returns the entry for [nodeID] and the key it is under
+func (n ZcashNodes) lookup(nodeID string) (ZcashEndpoint, string, bool) {
+	for key, endpoint := range n {
+		if trimNodeID(key) == trimNodeID(nodeID) {
+			return endpoint, key, true
+		}
+	}
+	return ZcashEndpoint{}, "", false
+}
+
+// nodeIDs returns the mapping's keys, sorted
+func (n ZcashNodes) nodeIDs() []string {
+	nodeIDs := make([]string, 0, len(n))
+	for nodeID := range n {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
+
+// redacted returns a copy of the mapping with passwords replaced
+func (n ZcashNodes) redacted() ZcashNodes {
+	if n == nil {
+		return nil
+	}
+	out := make(ZcashNodes, len(n))
+	for nodeID, endpoint := range n {
+		if endpoint.Password != "" {
+			endpoint.Password = redacted
+		}
+		out[nodeID] = endpoint
+	}
+	return out
+}
+
+func trimNodeID(nodeID string) string {
+	return strings.TrimPrefix(strings.TrimSpace(nodeID), nodeIDPrefix)
+}
+
+// readZcashNodesFile reads a JSON mapping file in the zcashNodes format
+func readZcashNodesFile(path string) (ZcashNodes, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading zcashNodesFile: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	nodes := ZcashNodes{}
+	if err := dec.Decode(&nodes); err != nil {
+		return nil, fmt.Errorf("error parsing zcashNodesFile %s: %w", path, err)
+	}
+	if problems := nodes.problems("zcashNodesFile " + path); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", errInvalidChainConfig, strings.Join(problems, "; "))
+	}
+	return nodes, nil
+}
+
+// zcashNodeEndpoint finds [nodeID]'s entry in zcashNodes or zcashNodesFile.
+// It returns false if neither is configured, and an error naming the
+// entries it looked at if [nodeID] has none.
+func (c *ChainConfig) zcashNodeEndpoint(nodeID string) (ZcashEndpoint, bool, error) {
+	if len(c.ZcashNodes) == 0 && c.ZcashNodesFile == "" {
+		return ZcashEndpoint{}, false, nil
+	}
+	if endpoint, key, ok := c.ZcashNodes.lookup(nodeID); ok {
+		log.Info("Using zcashd from the zcashNodes entry for this node", "entry", key)
+		return endpoint, true, nil
+	}
+	var fileNodes ZcashNodes
+	if c.ZcashNodesFile != "" {
+		var err error
+		if fileNodes, err = readZcashNodesFile(c.ZcashNodesFile); err != nil {
+			return ZcashEndpoint{}, true, err
+		}
+		if endpoint, key, ok := fileNodes.lookup(nodeID); ok {
+			log.Info("Using zcashd from the zcashNodesFile entry for this node", "file", c.ZcashNodesFile, "entry", key)
+			return endpoint, true, nil
+		}
+	}
+	return ZcashEndpoint{}, true, fmt.Errorf(
+		"no zcashd is mapped to node %s%s: zcashNodes has entries for %v and zcashNodesFile %q for %v",
+		nodeIDPrefix, trimNodeID(nodeID), c.ZcashNodes.nodeIDs(), c.ZcashNodesFile, fileNodes.nodeIDs(),
+	)
+}
+
+// avaSimEndpoint finds [nodeID]'s number in ~/node-ids/, where a local
+// ava-sim network writes node i's NodeID to the file named i, and returns
+// the zcashd ava-sim runs for that node
+func avaSimEndpoint(nodeID string) (ZcashEndpoint, error) {
+	home, _ := os.LookupEnv("HOME")
+	dir := filepath.Join(home, avaSimNodeIDs)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ZcashEndpoint{}, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	scanned := 0
+	for _, file := range files {
+		i, err := strconv.Atoi(file.Name())
+		if err != nil || i < 0 || file.IsDir() {
+			continue
+		}
+		scanned++
+		nid, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return ZcashEndpoint{}, fmt.Errorf("error reading node ID file: %w", err)
+		}
+		if trimNodeID(string(nid)) == trimNodeID(nodeID) {
+			port := avaSimBasePort + i + 1
+			log.Info("Using ava-sim zcashd for this node", "node number", i, "file", filepath.Join(dir, file.Name()), "zcash port", port)
+			return ZcashEndpoint{
+				Host:     zclient.ZcashHost,
+				Port:     port,
+				User:     zclient.ZcashUser,
+				Password: zclient.ZcashPw,
+			}, nil
+		}
+	}
+	return ZcashEndpoint{}, fmt.Errorf("node %s%s isn't in any of the %d node ID files in %s", nodeIDPrefix, trimNodeID(nodeID), scanned, dir)
+}
@@ -0,0 +1,270 @@
+package zapavm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// types a zcashrpc parameter rule can require
+const (
+	ParamTypeString = "string"
+	ParamTypeNumber = "number"
+	ParamTypeBool   = "bool"
+)
+
+var errZcashMethodDenied = errors.New("zcash method is not allowed through zcashrpc")
+
+// defaultAllowedZcashMethods are the read-only zcashd methods zcashrpc
+// forwards without configuration
+var defaultAllowedZcashMethods = []string{
+	"getbestblockhash",
+	"getblock",
+	"getblockchaininfo",
+	"getblockcount",
+	"getblockhash",
+	"getblockheader",
+	"getdifficulty",
+	"getinfo",
+	"getmempoolinfo",
+	"getmininginfo",
+	"getnetworkinfo",
+	"getrawmempool",
+	"getrawtransaction",
+	"getserializedblock",
+	"gettxout",
+	"listunspent",
+	"validateaddress",
+	"z_getbalance",
+	"z_getoperationstatus",
+	"z_gettotalbalance",
+	"z_listaddresses",
+	"z_listunspent",
+	"z_validateaddress",
+}
+
+// defaultDeniedZcashMethods are never forwarded, whatever the allowlist
+// says: they stop zcashd or expose or replace its keys
+var defaultDeniedZcashMethods = []string{
+	"backupwallet",
+	"dumpprivkey",
+	"dumpwallet",
+	"encryptwallet",
+	"importprivkey",
+	"importwallet",
+	"stop",
+	"walletpassphrase",
+	"walletpassphrasechange",
+	"z_exportkey",
+	"z_exportviewingkey",
+	"z_exportwallet",
+	"z_importkey",
+	"z_importviewingkey",
+	"z_importwallet",
+}
+
+// blockHashOrHeight matches the block hashes and heights getblock takes
+const blockHashOrHeight = "^([0-9a-fA-F]{64}|[0-9]+)$"
+
+func uintParam() ZcashRPCParamRule {
+	zero := float64(0)
+	return ZcashRPCParamRule{Type: ParamTypeNumber, Min: &zero}
+}
+
+func rangeParam(min, max float64) ZcashRPCParamRule {
+	return ZcashRPCParamRule{Type: ParamTypeNumber, Min: &min, Max: &max}
+}
+
+// defaultZcashParamRules validate the parameters of default methods whose
+// arguments are simple enough to check
+var defaultZcashParamRules = map[string][]ZcashRPCParamRule{
+	"getblock":           {{Type: ParamTypeString, Pattern: blockHashOrHeight}, rangeParam(0, 2)},
+	"getblockhash":       {uintParam()},
+	"getblockheader":     {{Type: ParamTypeString, Pattern: "^[0-9a-fA-F]{64}$"}, {Type: ParamTypeBool}},
+	"getserializedblock": {{Type: ParamTypeString, Pattern: "^[0-9]+$"}},
+}
+
+// ZcashRPCParamRule constrains one positional parameter of a zcashd method
+type ZcashRPCParamRule struct {
+	Type    string   `json:"type"`              // string, number or bool
+	Pattern string   `json:"pattern,omitempty"` // regular expression strings must match
+	Min     *float64 `json:"min,omitempty"`     // bounds of numbers, inclusive
+	Max     *float64 `json:"max,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ZcashRPCConfig configures which zcashd methods zcashrpc forwards. Allow
+// adds to the read-only defaults and Deny adds to the methods that are
+// never forwarded; denying wins. Params replaces the parameter rules of a
+// method: a call may pass at most one parameter per rule.
+type ZcashRPCConfig struct {
+	Allow  []string                       `json:"allow"`
+	Deny   []string                       `json:"deny"`
+	Params map[string][]ZcashRPCParamRule `json:"params"`
+}
+
+// ZcashRPCPolicy decides which zcashrpc calls are forwarded to zcashd
+type ZcashRPCPolicy struct {
+	allowed map[string]bool
+	denied  map[string]bool
+	params  map[string][]ZcashRPCParamRule
+}
+
+// NewZcashRPCPolicy builds the policy of [conf] over the defaults
+func NewZcashRPCPolicy(conf ZcashRPCConfig) (*ZcashRPCPolicy, error) {
+	policy := &ZcashRPCPolicy{
+		allowed: make(map[string]bool),
+		denied:  make(map[string]bool),
+		params:  make(map[string][]ZcashRPCParamRule),
+	}
+	for _, method := range append(defaultAllowedZcashMethods, conf.Allow...) {
+		policy.allowed[strings.ToLower(method)] = true
+	}
+	for _, method := range append(defaultDeniedZcashMethods, conf.Deny...) {
+		policy.denied[strings.ToLower(method)] = true
+	}
+	rules := make(map[string][]ZcashRPCParamRule, len(defaultZcashParamRules)+len(conf.Params))
+	for method, methodRules := range defaultZcashParamRules {
+		rules[method] = methodRules
+	}
+	for method, methodRules := range conf.Params {
+		rules[strings.ToLower(method)] = methodRules
+	}
+	for method, methodRules := range rules {
+		compiled := make([]ZcashRPCParamRule, len(methodRules))
+		for i, rule := range methodRules {
+			if rule.Pattern != "" {
+				pattern, err := regexp.Compile(rule.Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("zcashRPC.params.%s[%d]: %w", method, i, err)
+				}
+				rule.pattern = pattern
+			}
+			compiled[i] = rule
+		}
+		policy.params[method] = compiled
+	}
+	return policy, nil
+}
+
+// problems lists what's invalid about the config, prefixing fields with [field]
+func (c ZcashRPCConfig) problems(field string) []string {
+	var problems []string
+	for i, method := range c.Allow {
+		for _, denied := range defaultDeniedZcashMethods {
+			if strings.EqualFold(method, denied) {
+				problems = append(problems, fmt.Sprintf("%s.allow[%d]: %s is always denied", field, i, method))
+			}
+		}
+	}
+	for method, rules := range c.Params {
+		for i, rule := range rules {
+			switch rule.Type {
+			case ParamTypeString, ParamTypeNumber, ParamTypeBool:
+			default:
+				problems = append(problems, fmt.Sprintf("%s.params.%s[%d]: unknown type %q, expected %q, %q or %q", field, method, i, rule.Type, ParamTypeString, ParamTypeNumber, ParamTypeBool))
+			}
+			if rule.Pattern != "" {
+				if rule.Type != ParamTypeString {
+					problems = append(problems, fmt.Sprintf("%s.params.%s[%d]: pattern only applies to strings", field, method, i))
+				}
+				if _, err := regexp.Compile(rule.Pattern); err != nil {
+					problems = append(problems, fmt.Sprintf("%s.params.%s[%d]: %s", field, method, i, err))
+				}
+			}
+			if (rule.Min != nil || rule.Max != nil) && rule.Type != ParamTypeNumber {
+				problems = append(problems, fmt.Sprintf("%s.params.%s[%d]: min and max only apply to numbers", field, method, i))
+			}
+			if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+				problems = append(problems, fmt.Sprintf("%s.params.%s[%d]: min is above max", field, method, i))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Check returns an error saying why calling [method] with [params] isn't
+// allowed, or nil if it is
+func (p *ZcashRPCPolicy) Check(method string, params []interface{}) error {
+	name := strings.ToLower(method)
+	if p.denied[name] {
+		return fmt.Errorf("%w: %s is denied", errZcashMethodDenied, method)
+	}
+	if !p.allowed[name] {
+		return fmt.Errorf("%w: %s isn't in the allowlist, see zapavm.listAllowedZcashMethods", errZcashMethodDenied, method)
+	}
+	rules, ok := p.params[name]
+	if !ok {
+		return nil
+	}
+	if len(params) > len(rules) {
+		return fmt.Errorf("%w: %s takes at most %d parameters, got %d", errZcashMethodDenied, method, len(rules), len(params))
+	}
+	for i, param := range params {
+		if err := rules[i].check(param); err != nil {
+			return fmt.Errorf("%w: %s parameter %d %s", errZcashMethodDenied, method, i, err)
+		}
+	}
+	return nil
+}
+
+func (r ZcashRPCParamRule) check(param interface{}) error {
+	switch r.Type {
+	case ParamTypeString:
+		s, ok := param.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if r.pattern != nil && !r.pattern.MatchString(s) {
+			return fmt.Errorf("must match %s", r.Pattern)
+		}
+	case ParamTypeNumber:
+		n, ok := param.(float64)
+		if !ok {
+			return fmt.Errorf("must be a number")
+		}
+		if r.Min != nil && n < *r.Min {
+			return fmt.Errorf("must be at least %v", *r.Min)
+		}
+		if r.Max != nil && n > *r.Max {
+			return fmt.Errorf("must be at most %v", *r.Max)
+		}
+	case ParamTypeBool:
+		if _, ok := param.(bool); !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+	}
+	return nil
+}
+
+// Allowed returns the methods zcashrpc forwards, sorted, with their
+// parameter rules
+func (p *ZcashRPCPolicy) Allowed() ([]string, map[string][]ZcashRPCParamRule) {
+	var methods []string
+	params := make(map[string][]ZcashRPCParamRule)
+	for method := range p.allowed {
+		if p.denied[method] {
+			continue
+		}
+		methods = append(methods, method)
+		if rules, ok := p.params[method]; ok {
+			params[method] = rules
+		}
+	}
+	sort.Strings(methods)
+	return methods, params
+}
+
+// Denied returns the methods zcashrpc never forwards, sorted
+func (p *ZcashRPCPolicy) Denied() []string {
+	methods := make([]string, 0, len(p.denied))
+	for method := range p.denied {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -0,0 +1,84 @@
+package zapavm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestZcashRPCPolicyCheck(t *testing.T) {
+	one := float64(1)
+	policy, err := NewZcashRPCPolicy(ZcashRPCConfig{
+		Allow: []string{"Z_SendMany", "getpeerinfo", "dumpprivkey"},
+		Deny:  []string{"getrawmempool"},
+		Params: map[string][]ZcashRPCParamRule{
+			"GetBlockHash": {{Type: ParamTypeNumber, Min: &one}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := "00040fe8ec8471911baa1db1266ea15dd06b4a8a5c453883c000b031973dce08"
+	tests := []struct {
+		name    string
+		method  string
+		params  []interface{}
+		allowed bool
+	}{
+		{"default method", "getblockcount", nil, true},
+		{"default method in other casing", "GetBlockCount", nil, true},
+		{"configured method", "getpeerinfo", nil, true},
+		{"configured method in other casing", "z_sendmany", []interface{}{"from", []interface{}{}}, true},
+		{"unlisted method", "sendtoaddress", nil, false},
+		{"default denied method", "stop", nil, false},
+		{"default denied method in other casing", "Z_ExportWallet", []interface{}{"file"}, false},
+		{"denied method allowed in config", "dumpprivkey", nil, false},
+		{"default method denied in config", "getrawmempool", nil, false},
+		{"getblock by hash", "getblock", []interface{}{hash, float64(1)}, true},
+		{"getblock by height", "getblock", []interface{}{"12"}, true},
+		{"getblock bad hash", "getblock", []interface{}{"not-a-hash"}, false},
+		{"getblock numeric height", "getblock", []interface{}{float64(12)}, false},
+		{"getblock verbosity too high", "getblock", []interface{}{hash, float64(3)}, false},
+		{"getblock too many params", "getblock", []interface{}{hash, float64(1), true}, false},
+		{"getblockheader bool param", "getblockheader", []interface{}{hash, false}, true},
+		{"getblockheader non-bool param", "getblockheader", []interface{}{hash, "false"}, false},
+		{"configured rules replace defaults", "getblockhash", []interface{}{float64(0)}, false},
+		{"configured rules", "getblockhash", []interface{}{float64(1)}, true},
+		{"method without rules", "getinfo", []interface{}{"anything", float64(-1)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Check(test.method, test.params)
+			if test.allowed && err != nil {
+				t.Fatalf("Check() = %v, expected nil", err)
+			}
+			if !test.allowed && !errors.Is(err, errZcashMethodDenied) {
+				t.Fatalf("Check() = %v, expected %v", err, errZcashMethodDenied)
+			}
+		})
+	}
+}
+
+func TestZcashRPCConfigProblems(t *testing.T) {
+	one, two := float64(1), float64(2)
+	tests := []struct {
+		name string
+		conf ZcashRPCConfig
+		want int
+	}{
+		{"empty", ZcashRPCConfig{}, 0},
+		{"allow denied method", ZcashRPCConfig{Allow: []string{"Stop"}}, 1},
+		{"unknown type", ZcashRPCConfig{Params: map[string][]ZcashRPCParamRule{"m": {{Type: "array"}}}}, 1},
+		{"pattern on number", ZcashRPCConfig{Params: map[string][]ZcashRPCParamRule{"m": {{Type: ParamTypeNumber, Pattern: "x"}}}}, 1},
+		{"bad pattern", ZcashRPCConfig{Params: map[string][]ZcashRPCParamRule{"m": {{Type: ParamTypeString, Pattern: "("}}}}, 1},
+		{"bounds on string", ZcashRPCConfig{Params: map[string][]ZcashRPCParamRule{"m": {{Type: ParamTypeString, Min: &one}}}}, 1},
+		{"min above max", ZcashRPCConfig{Params: map[string][]ZcashRPCParamRule{"m": {{Type: ParamTypeNumber, Min: &two, Max: &one}}}}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if problems := test.conf.problems("zcashRPC"); len(problems) != test.want {
+				t.Fatalf("problems() = %q, expected %d problems", problems, test.want)
+			}
+		})
+	}
+}
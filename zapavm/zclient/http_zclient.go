@@ -93,6 +93,69 @@ func (zc *ZcashHTTPClient) GetZBlock(height int) ZcashBlockResult {
 	return blockResultFromResp(resp)
 }
 
+// GetBlockHash returns the hash of the block at [height] in zcashd's active chain
+func (zc *ZcashHTTPClient) GetBlockHash(height int) (string, error) {
+	resp := zc.CallZcashJson("getblockhash", []interface{}{height})
+	if resp.Error != nil {
+		return "", resp.Error.Error()
+	}
+	var hash string
+	if err := nativejson.Unmarshal(resp.Result, &hash); err != nil {
+		return "", fmt.Errorf("error unmarshalling block hash: %w", err)
+	}
+	return hash, nil
+}
+
+// InvalidateBlock marks the block with [hash] and its descendants invalid,
+// rolling zcashd's active chain back to the block's parent
+func (zc *ZcashHTTPClient) InvalidateBlock(hash string) error {
+	resp := zc.CallZcashJson("invalidateblock", []interface{}{hash})
+	if resp.Error != nil {
+		return resp.Error.Error()
+	}
+	return nil
+}
+
+// ReconsiderBlock clears the invalid flag InvalidateBlock set on the block
+// with [hash] and its descendants
+func (zc *ZcashHTTPClient) ReconsiderBlock(hash string) error {
+	resp := zc.CallZcashJson("reconsiderblock", []interface{}{hash})
+	if resp.Error != nil {
+		return resp.Error.Error()
+	}
+	return nil
+}
+
+// GetBlockTxIDs returns the IDs of the transactions in the block with [hash]
+func (zc *ZcashHTTPClient) GetBlockTxIDs(hash string) ([]string, error) {
+	resp := zc.CallZcashJson("getblock", []interface{}{hash, 1})
+	if resp.Error != nil {
+		return nil, resp.Error.Error()
+	}
+	var blk struct {
+		Tx []string `json:"tx"`
+	}
+	if err := nativejson.Unmarshal(resp.Result, &blk); err != nil {
+		return nil, fmt.Errorf("error unmarshalling block: %w", err)
+	}
+	return blk.Tx, nil
+}
+
+// GetNetwork returns the zcash network zcashd runs: "main", "test" or "regtest"
+func (zc *ZcashHTTPClient) GetNetwork() (string, error) {
+	resp := zc.CallZcashJson("getblockchaininfo", nil)
+	if resp.Error != nil {
+		return "", resp.Error.Error()
+	}
+	var info struct {
+		Chain string `json:"chain"`
+	}
+	if err := nativejson.Unmarshal(resp.Result, &info); err != nil {
+		return "", fmt.Errorf("error unmarshalling blockchain info: %w", err)
+	}
+	return info.Chain, nil
+}
+
 func (zc *ZcashHTTPClient) CallZcashJson(method string, params []interface{}) ZCashResponse {
 	log.Info("ZcashHTTPClient.CallZcashJson", "Method", method, "Params", params, "Complete Host", zc.GetCompleteHost())
 
@@ -106,8 +169,8 @@ func (zc *ZcashHTTPClient) CallZcashJson(method string, params []interface{}) ZC
 	return zc.getZcashResponse(b)
 }
 
-func (zc *ZcashHTTPClient) ValidateBlock(zblk nativejson.RawMessage) error {
-	r := zc.CallZcash("validateBlock", zblk)
+func (zc *ZcashHTTPClient) ValidateBlock(zblk []byte) error {
+	r := zc.CallZcash("validateBlock", EncodeZBlock(zblk))
 	if r.Error != nil {
 		log.Error("validate block call did not succeed", "error", r.Error)
 		return r.Error.Error()
@@ -120,8 +183,8 @@ func (zc *ZcashHTTPClient) ValidateBlock(zblk nativejson.RawMessage) error {
 	return nil
 }
 
-func (zc *ZcashHTTPClient) SubmitBlock(zblk nativejson.RawMessage) error {
-	resp := zc.CallZcash("submitblock", zblk)
+func (zc *ZcashHTTPClient) SubmitBlock(zblk []byte) error {
+	resp := zc.CallZcash("submitblock", EncodeZBlock(zblk))
 	if resp.Error != nil {
 		return resp.Error.Error()
 	}
@@ -159,8 +222,12 @@ func (zc *ZcashHTTPClient) CallZcash(method string, zresult nativejson.RawMessag
 
 func blockResultFromResp(resp ZCashResponse) ZcashBlockResult {
 	log.Debug("ZcashHTTPClient.blockResultFromResp: begin")
-	var arr []ZcashBlockResult
+	var arr []zcashBlockResultJson
 	zbr := ZcashBlockResult{}
+	if resp.Error != nil {
+		zbr.Error = resp.Error.Error()
+		return zbr
+	}
 	err := nativejson.Unmarshal(resp.Result, &arr)
 	if err != nil {
 		log.Error("Error unmarshalling block result", "error", err)
@@ -172,7 +239,9 @@ func blockResultFromResp(resp ZCashResponse) ZcashBlockResult {
 		zbr.Error = errstr
 		return zbr
 	}
-	return arr[0]
+	zbr.Timestamp = arr[0].Timestamp
+	zbr.Block, zbr.Error = DecodeZBlock(arr[0].Block)
+	return zbr
 }
 
 func (zc *ZcashHTTPClient) getZcashResponse(b []byte) ZCashResponse {
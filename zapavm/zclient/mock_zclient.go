@@ -49,18 +49,20 @@ func (zc *ZCashMockClient) GetZBlock(height int) ZcashBlockResult {
 	h, _ := os.LookupEnv("HOME")
 	fname := h + "repos/zapa/zapavm/zapavm/mocks/block" + strconv.Itoa(height + 1) + ".json"
 	plan, _ := ioutil.ReadFile(fname)
+	zblk, err := DecodeZBlock(plan)
 	return ZcashBlockResult{
-		Block: plan,
+		Block: zblk,
 		Timestamp: int64(height),
+		Error: err,
 	}
 }
 
-func (zc *ZCashMockClient) ValidateBlock(zblk nativejson.RawMessage) error {
+func (zc *ZCashMockClient) ValidateBlock(zblk []byte) error {
 	log.Info("ZCMockClient.ValidateBlock. Naively returning nil indicating a valid block")
 	return nil
 }
 
-func (zc *ZCashMockClient) SubmitBlock(zblk nativejson.RawMessage) error {
+func (zc *ZCashMockClient) SubmitBlock(zblk []byte) error {
 	log.Info("ZCMockClient.Submit. Naively returning nil indicating a success")
 	return nil
 }
@@ -83,4 +85,33 @@ func (zc *ZCashMockClient) CallZcashJson(method string, params []interface{}) ZC
 
 	return ZCashResponse{Error: &ZcashError{Message: errString, Code: ZcashClientErrorCode}}
 
-}
\ No newline at end of file
+}
+
+func (zc *ZCashMockClient) GetBlockHash(height int) (string, error) {
+	log.Info("ZCMockClient.GetBlockHash. Hashing the mock block", "height", height)
+	res := zc.GetZBlock(height)
+	if res.Error != nil {
+		return "", res.Error
+	}
+	return ZBlockHash(res.Block)
+}
+
+func (zc *ZCashMockClient) InvalidateBlock(hash string) error {
+	log.Info("ZCMockClient.InvalidateBlock. Naively returning nil indicating a success", "hash", hash)
+	return nil
+}
+
+func (zc *ZCashMockClient) ReconsiderBlock(hash string) error {
+	log.Info("ZCMockClient.ReconsiderBlock. Naively returning nil indicating a success", "hash", hash)
+	return nil
+}
+
+func (zc *ZCashMockClient) GetBlockTxIDs(hash string) ([]string, error) {
+	log.Warn("ZCMockClient.GetBlockTxIDs. Returning no transactions", "hash", hash)
+	return nil, nil
+}
+
+func (zc *ZCashMockClient) GetNetwork() (string, error) {
+	log.Info("ZCMockClient.GetNetwork. Returning regtest")
+	return "regtest", nil
+}
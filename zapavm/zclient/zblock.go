@@ -0,0 +1,80 @@
+package zclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// zcash block headers are laid out as
+// nVersion (4) | hashPrevBlock (32) | hashMerkleRoot (32) |
+// hashBlockCommitments (32) | nTime (4) | nBits (4) | nNonce (32) |
+// nSolution (compact size + solution)
+const zblockHeaderPrefixLen = 4 + 32 + 32 + 32 + 4 + 4 + 32
+
+var errShortZBlock = errors.New("zcash block is too short to hold a block header")
+
+// zblockHeaderLen returns the length of the block header at the start of
+// the raw zcash block [zblk]
+func zblockHeaderLen(zblk []byte) (int, error) {
+	if len(zblk) < zblockHeaderPrefixLen+1 {
+		return 0, errShortZBlock
+	}
+	solutionLen, sizeLen, err := readCompactSize(zblk[zblockHeaderPrefixLen:])
+	if err != nil {
+		return 0, err
+	}
+	headerLen := zblockHeaderPrefixLen + sizeLen + int(solutionLen)
+	if solutionLen > uint64(len(zblk)) || headerLen > len(zblk) {
+		return 0, errShortZBlock
+	}
+	return headerLen, nil
+}
+
+// ZBlockHash returns the hash of the raw zcash block [zblk] in the byte
+// order zcashd displays it, i.e. what getblockhash returns
+func ZBlockHash(zblk []byte) (string, error) {
+	headerLen, err := zblockHeaderLen(zblk)
+	if err != nil {
+		return "", err
+	}
+	first := sha256.Sum256(zblk[:headerLen])
+	hash := sha256.Sum256(first[:])
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// readCompactSize reads a bitcoin style variable length integer from the
+// start of [b] and returns it along with the number of bytes it took up
+func readCompactSize(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errShortZBlock
+	}
+	switch b[0] {
+	case 0xfd:
+		if len(b) < 3 {
+			return 0, 0, errShortZBlock
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:])), 3, nil
+	case 0xfe:
+		if len(b) < 5 {
+			return 0, 0, errShortZBlock
+		}
+		return uint64(binary.LittleEndian.Uint32(b[1:])), 5, nil
+	case 0xff:
+		if len(b) < 9 {
+			return 0, 0, errShortZBlock
+		}
+		n := binary.LittleEndian.Uint64(b[1:])
+		if n > uint64(len(b)) {
+			return 0, 0, fmt.Errorf("compact size %d exceeds zcash block length", n)
+		}
+		return n, 9, nil
+	default:
+		return uint64(b[0]), 1, nil
+	}
+}
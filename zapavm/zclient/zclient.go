@@ -1,6 +1,7 @@
 package zclient
 
 import (
+	"encoding/hex"
 	nativejson "encoding/json"
 	"fmt"
 
@@ -32,10 +33,18 @@ type ZCashRequestJson struct {
 	ID     string                `json:"id"`
 }
 
+// ZcashBlockResult is a zcash block as handed to the VM. Block holds the raw
+// serialized zcash block; zcashd's hex form only exists at the RPC boundary.
 type ZcashBlockResult struct {
-	Block nativejson.RawMessage `json:"block"`
-	Timestamp int64             `json:"timestamp"`
-	Error error
+	Block     []byte
+	Timestamp int64
+	Error     error
+}
+
+// zcashBlockResultJson is the wire form of ZcashBlockResult returned by zcashd
+type zcashBlockResultJson struct {
+	Block     nativejson.RawMessage `json:"block"`
+	Timestamp int64                 `json:"timestamp"`
 }
 
 type ZcashClient interface {
@@ -44,11 +53,16 @@ type ZcashClient interface {
 	SendMany(from string, to string, amount float32) ZCashResponse
 	GetBlockCount() (int, error)
 	GetZBlock(height int) ZcashBlockResult
-	ValidateBlock(zblk nativejson.RawMessage) error
-	SubmitBlock(zblk nativejson.RawMessage) error
+	ValidateBlock(zblk []byte) error
+	SubmitBlock(zblk []byte) error
 	SuggestBlock() ZcashBlockResult
 	CallZcash(method string, zresult nativejson.RawMessage) ZCashResponse
 	CallZcashJson(method string, params []interface{}) ZCashResponse
+	GetBlockHash(height int) (string, error)
+	InvalidateBlock(hash string) error
+	ReconsiderBlock(hash string) error
+	GetBlockTxIDs(hash string) ([]string, error)
+	GetNetwork() (string, error)
 }
 
 func BlockGenerator(zc ZcashClient) chan ZcashBlockResult {
@@ -73,6 +87,31 @@ func BlockGenerator(zc ZcashClient) chan ZcashBlockResult {
 	return c
 }
 
+// EncodeZBlock wraps a raw zcash block in the JSON hex string zcashd expects
+func EncodeZBlock(zblk []byte) nativejson.RawMessage {
+	b, _ := nativejson.Marshal(hex.EncodeToString(zblk))
+	return b
+}
+
+// DecodeZBlock unwraps the JSON hex string zcashd returns into the raw zcash block
+func DecodeZBlock(raw nativejson.RawMessage) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var s string
+	if err := nativejson.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("zcash block is not a JSON string: %w", err)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	zblk, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("zcash block is not valid hex: %w", err)
+	}
+	return zblk, nil
+}
+
 func (zc *ZcashError) Error() error {
 	return fmt.Errorf("Message: %s ; Code: %d", zc.Message, zc.Code)
 }